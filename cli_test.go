@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -46,6 +47,7 @@ var _ = Describe("Running the CLI", func() {
 		session = cli(path,
 			"--port", strconv.Itoa(port),
 			"--work-path", workPath,
+			"--insecure-no-auth",
 			"--flush-size=100",
 			"--buffer-size=100000",
 			"--s3-access-key-id", "minio",
@@ -69,7 +71,7 @@ var _ = Describe("Running the CLI", func() {
 
 	It("runs successfully", Serial, Label("measurement"), func() {
 		By("sending a single event", func() {
-			err := client.SendEvent(sdk.Event{
+			err := client.SendEvent(context.Background(), sdk.Event{
 				Time: sdk.Time(time.Now().UnixNano()),
 				Labels: sdk.Labels{
 					"hello": "world",
@@ -88,7 +90,7 @@ var _ = Describe("Running the CLI", func() {
 
 			// measure how long it takes to RecomputePages() and store the duration in a "repagination" measurement
 			experiment.MeasureDuration("send event", func() {
-				_ = client.SendEvent(sdk.Event{
+				_ = client.SendEvent(context.Background(), sdk.Event{
 					Time: sdk.Time(time.Now().UnixNano()),
 					Labels: sdk.Labels{
 						"user_id":    "1234",
@@ -100,13 +102,13 @@ var _ = Describe("Running the CLI", func() {
 		}, gmeasure.SamplingConfig{N: 1000, Duration: 10 * time.Second}) // we'll sample the function up to 20 times or up to a minute, whichever comes first.
 
 		By("can /ping", func() {
-			ok, err := client.Ping()
+			ok, err := client.Ping(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ok).To(BeTrue())
 		})
 
 		By("increases the insert operations", func() {
-			stats, err := client.Stats()
+			stats, err := client.Stats(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(stats.Count.Insert).To(BeEquivalentTo(1001))
 		})
@@ -2,25 +2,27 @@ package cmd
 
 import (
 	"fmt"
-	"net/http"
 	"net/url"
-	"sync/atomic"
+	"os"
+	"strings"
 
 	"github.com/c2fo/vfs/v6/backend"
 	"github.com/c2fo/vfs/v6/backend/s3"
-	"github.com/jtarchie/sqlite-tsdb/sdk"
-	"github.com/jtarchie/sqlite-tsdb/server"
 	"github.com/jtarchie/sqlite-tsdb/services"
-	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
 type CLI struct {
-	Port       int    `help:"port for http server" required:""`
-	FlushSize  int    `help:"numbers of items to flush to large file store"`
-	BufferSize int    `help:"size of in-memory buffer" default:"100"`
-	WorkPath   string `type:"existingdir" help:"store database in directory" required:""`
-	S3         struct {
+	Server  ServerCmd  `cmd:"" default:"withargs" help:"run the http server for writing events"`
+	Query   QueryCmd   `cmd:"" help:"run a SQL query over a time range against the bucket"`
+	Ls      LsCmd      `cmd:"" help:"list persisted files with their time ranges and counts"`
+	Get     GetCmd     `cmd:"" help:"download a persisted file for use with sqlite3"`
+	Compact CompactCmd `cmd:"" help:"merge small persisted files into larger ones"`
+}
+
+// Storage is the bucket configuration shared by all commands.
+type Storage struct {
+	S3 struct {
 		AccessKeyID     string `help:"access key to the s3 bucket"`
 		SecretAccessKey string `help:"secret access key to the s3 bucket"`
 
@@ -33,73 +35,68 @@ type CLI struct {
 	} `embed:"" prefix:"s3-" group:"s3" help:"where to store the sqlite databases"`
 }
 
-func (cli *CLI) Run(logger *zap.Logger) error {
-	stats := sdk.StatsPayload{}
-
-	cli.registerBucketAuth()
-
-	writer, err := services.NewSwitcher(
-		cli.WorkPath,
-		cli.FlushSize,
-		cli.BufferSize,
-		services.NewPersistence(
-			fmt.Sprintf("s3://%s", cli.S3.Bucket),
-			logger,
-		),
-		logger,
-	)
-	if err != nil {
-		return fmt.Errorf("could not create switcher: %w", err)
-	}
-
-	e := echo.New()
-	e.Use(server.ZapLogger(logger))
-
-	e.GET("/ping", func(c echo.Context) error {
-		//nolint: wrapcheck
-		return c.String(http.StatusOK, `{"status":"OK"}`)
-	})
-
-	e.PUT("/api/events", func(c echo.Context) error {
-		event := &sdk.Event{}
-
-		err := c.Bind(event)
-		if err != nil {
-			logger.Error("could not parse event JSON", zap.Error(err))
+func (s *Storage) persistence(logger *zap.Logger) *services.Persistence {
+	s.registerBucketAuth()
 
-			//nolint: wrapcheck
-			return c.NoContent(http.StatusUnprocessableEntity)
-		}
-
-		writer.Insert(event)
-		atomic.AddUint64(&stats.Count.Insert, 1)
-
-		//nolint: wrapcheck
-		return c.NoContent(http.StatusCreated)
-	})
+	return services.NewPersistence(s.remoteLocationPrefix(), logger)
+}
 
-	e.GET("/api/stats", func(c echo.Context) error {
-		//nolint: wrapcheck
-		return c.JSON(http.StatusOK, stats)
-	})
+func (s *Storage) remoteLocationPrefix() string {
+	prefix := fmt.Sprintf("s3://%s", s.S3.Bucket)
 
-	e.Logger.Fatal(e.Start(fmt.Sprintf(":%d", cli.Port)))
+	path := strings.Trim(s.S3.Path, "/")
+	if path != "" {
+		prefix = fmt.Sprintf("%s/%s", prefix, path)
+	}
 
-	return nil
+	return prefix
 }
 
-func (cli *CLI) registerBucketAuth() {
+func (s *Storage) registerBucketAuth() {
+	endpoint := ""
+	if s.S3.Endpoint != nil {
+		endpoint = s.S3.Endpoint.String()
+	}
+
 	backend.Register(
-		fmt.Sprintf("s3://%s", cli.S3.Bucket),
+		fmt.Sprintf("s3://%s", s.S3.Bucket),
 		s3.NewFileSystem().WithOptions(
 			s3.Options{
-				AccessKeyID:                 cli.S3.AccessKeyID,
-				SecretAccessKey:             cli.S3.SecretAccessKey,
-				Region:                      cli.S3.Region,
-				Endpoint:                    cli.S3.Endpoint.String(),
-				ForcePathStyle:              cli.S3.ForcePathStyle,
+				AccessKeyID:                 s.S3.AccessKeyID,
+				SecretAccessKey:             s.S3.SecretAccessKey,
+				Region:                      s.S3.Region,
+				Endpoint:                    endpoint,
+				ForcePathStyle:              s.S3.ForcePathStyle,
 				DisableServerSideEncryption: true,
 			},
 		),
 	)
 }
+
+// Window is the time range flags shared by commands that read the bucket.
+type Window struct {
+	Start string `help:"start of the time range (RFC3339, date, or unix nanoseconds)"`
+	End   string `help:"end of the time range (RFC3339, date, or unix nanoseconds)"`
+}
+
+func (w *Window) timeRange() (services.TimeRange, error) {
+	timeRange, err := services.NewTimeRange(w.Start, w.End)
+	if err != nil {
+		return services.TimeRange{}, fmt.Errorf("could not parse time range: %w", err)
+	}
+
+	return timeRange, nil
+}
+
+// Scratch is a local directory for downloaded files.
+type Scratch struct {
+	WorkPath string `type:"existingdir" help:"directory for downloaded files (defaults to the system temp directory)"`
+}
+
+func (s *Scratch) workPath() string {
+	if s.WorkPath == "" {
+		return os.TempDir()
+	}
+
+	return s.WorkPath
+}
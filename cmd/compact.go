@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	"go.uber.org/zap"
+)
+
+type CompactCmd struct {
+	Storage `embed:""`
+	Window  `embed:""`
+	Scratch `embed:""`
+
+	MaxCount int64 `help:"maximum number of events in a compacted file" default:"100000"`
+	DryRun   bool  `help:"only print the files that would be merged"`
+}
+
+func (cmd *CompactCmd) Run(logger *zap.Logger) error {
+	timeRange, err := cmd.timeRange()
+	if err != nil {
+		return err
+	}
+
+	persistence := cmd.persistence(logger)
+	reader := services.NewReader(persistence, cmd.workPath(), logger)
+	compactor := services.NewCompactor(persistence, cmd.workPath(), logger)
+
+	files, err := reader.Files(timeRange)
+	if err != nil {
+		return fmt.Errorf("could not list files: %w", err)
+	}
+
+	for _, group := range compactor.Plan(files, cmd.MaxCount) {
+		names := make([]string, 0, len(group))
+		for _, file := range group {
+			names = append(names, file.Name)
+		}
+
+		if cmd.DryRun {
+			fmt.Printf("would merge %v\n", names)
+
+			continue
+		}
+
+		name, err := compactor.Compact(group)
+		if err != nil {
+			return fmt.Errorf("could not compact %v: %w", names, err)
+		}
+
+		fmt.Printf("merged %v into %s\n", names, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+type GetCmd struct {
+	Storage `embed:""`
+
+	Name   string `arg:"" help:"name of the persisted file"`
+	Output string `short:"o" help:"local path to write the file to (defaults to the name)"`
+}
+
+func (cmd *GetCmd) Run(logger *zap.Logger) error {
+	output := cmd.Output
+	if output == "" {
+		output = cmd.Name
+	}
+
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return fmt.Errorf("could not resolve output path: %w", err)
+	}
+
+	err = cmd.persistence(logger).Download(cmd.Name, output)
+	if err != nil {
+		return fmt.Errorf("could not get file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	"go.uber.org/zap"
+)
+
+type LsCmd struct {
+	Storage `embed:""`
+	Window  `embed:""`
+	Scratch `embed:""`
+
+	RebuildCatalog bool `help:"inspect every persisted file and rewrite the catalog before listing"`
+}
+
+func (cmd *LsCmd) Run(logger *zap.Logger) error {
+	timeRange, err := cmd.timeRange()
+	if err != nil {
+		return err
+	}
+
+	persistence := cmd.persistence(logger)
+
+	if cmd.RebuildCatalog {
+		_, err = persistence.RebuildCatalog(cmd.workPath())
+		if err != nil {
+			return fmt.Errorf("could not rebuild catalog: %w", err)
+		}
+	}
+
+	reader := services.NewReader(persistence, cmd.workPath(), logger)
+
+	files, err := reader.Files(timeRange)
+	if err != nil {
+		return fmt.Errorf("could not list files: %w", err)
+	}
+
+	const padding = 2
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, padding, ' ', 0)
+
+	fmt.Fprintln(table, "NAME\tSTART\tEND\tCOUNT\tSIZE")
+
+	for _, file := range files {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\n",
+			file.Name,
+			file.MinTime.Format(time.RFC3339Nano),
+			file.MaxTime.Format(time.RFC3339Nano),
+			file.Count,
+			file.Size,
+		)
+	}
+
+	err = table.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write table: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	"go.uber.org/zap"
+)
+
+type QueryCmd struct {
+	Storage `embed:""`
+	Window  `embed:""`
+	Scratch `embed:""`
+
+	Timeout     time.Duration `help:"stop the query after this long, unlimited when 0"`
+	Concurrency int           `help:"files downloaded at once" default:"4"`
+
+	SQL string `arg:"" help:"SQL query to run against the events of every file"`
+}
+
+func (cmd *QueryCmd) Run(logger *zap.Logger) error {
+	timeRange, err := cmd.timeRange()
+	if err != nil {
+		return err
+	}
+
+	reader := services.NewReader(cmd.persistence(logger), cmd.workPath(), logger)
+	reader.SetLimits(services.QueryLimits{
+		Timeout:     cmd.Timeout,
+		Concurrency: cmd.Concurrency,
+	})
+	encoder := json.NewEncoder(os.Stdout)
+
+	plan, err := reader.Plan(cmd.SQL, timeRange)
+	if err != nil {
+		return fmt.Errorf("could not plan query: %w", err)
+	}
+
+	logger.Info("planned query", zap.Int("scanned", len(plan.Files)), zap.Int("skipped", plan.Skipped))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = reader.Execute(ctx, plan, cmd.SQL, func(columns []string, values []any) error {
+		if values == nil {
+			return nil
+		}
+
+		row := make(map[string]any, len(columns))
+		for index, column := range columns {
+			row[column] = values[index]
+		}
+
+		//nolint: wrapcheck
+		return encoder.Encode(row)
+	})
+	if err != nil {
+		return fmt.Errorf("could not query: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// queryJobs are the handlers for queries run in the background. A job can
+// only be seen by the principal that submitted it.
+type queryJobs struct {
+	jobs   *services.Jobs
+	logger *zap.Logger
+}
+
+func (q *queryJobs) submit(c echo.Context) error {
+	request := &sdk.QueryRequest{}
+
+	err := c.Bind(request)
+	if errors.Is(err, server.ErrBodyTooLarge) {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "query body is too large")
+	}
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "could not parse query JSON")
+	}
+
+	timeRange, err := services.NewTimeRange(request.Range.Start, request.Range.End)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	job, err := q.jobs.Submit(server.PrincipalFrom(c).Name, request.Query, timeRange)
+	if errors.Is(err, services.ErrMultipleStatements) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if errors.Is(err, services.ErrTooManyJobs) {
+		return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	}
+
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	//nolint: wrapcheck
+	return c.JSON(http.StatusAccepted, jobPayload(job))
+}
+
+func (q *queryJobs) status(c echo.Context) error {
+	job, err := q.find(c)
+	if err != nil {
+		return err
+	}
+
+	//nolint: wrapcheck
+	return c.JSON(http.StatusOK, jobPayload(job))
+}
+
+func (q *queryJobs) results(c echo.Context) error {
+	job, err := q.find(c)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != services.JobSucceeded {
+		return echo.NewHTTPError(http.StatusConflict, "query job is "+string(job.Status))
+	}
+
+	return streamRows(c, q.logger, func(fn services.RowFunc) error {
+		return q.jobs.Results(job.ID, fn)
+	})
+}
+
+func (q *queryJobs) cancel(c echo.Context) error {
+	job, err := q.find(c)
+	if err != nil {
+		return err
+	}
+
+	err = q.jobs.Delete(job.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+
+	//nolint: wrapcheck
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (q *queryJobs) find(c echo.Context) (services.Job, error) {
+	job, err := q.jobs.Get(c.Param("id"))
+	if err != nil || job.Owner != server.PrincipalFrom(c).Name {
+		return services.Job{}, echo.NewHTTPError(http.StatusNotFound, services.ErrJobNotFound.Error())
+	}
+
+	return job, nil
+}
+
+func jobPayload(job services.Job) sdk.QueryJob {
+	payload := sdk.QueryJob{
+		ID:         job.ID,
+		Query:      job.Query,
+		Status:     sdk.QueryJobStatus(job.Status),
+		FilesDone:  job.FilesDone,
+		FilesTotal: job.FilesTotal,
+		Rows:       job.Rows,
+		Error:      job.Error,
+		CreatedAt:  job.CreatedAt,
+	}
+
+	if !job.FinishedAt.IsZero() {
+		payload.FinishedAt = &job.FinishedAt
+	}
+
+	return payload
+}
@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+type ServerCmd struct {
+	Storage `embed:""`
+
+	Port       int    `help:"port for http server" required:""`
+	FlushSize  int    `help:"numbers of items to flush to large file store"`
+	BufferSize int    `help:"size of in-memory buffer" default:"100"`
+	WorkPath   string `type:"existingdir" help:"store database in directory" required:""`
+
+	ReadyMaxPending int64 `help:"number of databases waiting to be uploaded before reporting not ready" default:"10"`
+
+	OverflowPolicy  string        `help:"what to do with events when the buffer is full (drop-oldest, reject, block)" enum:"drop-oldest,reject,block" default:"drop-oldest"`
+	OverflowTimeout time.Duration `help:"how long the block policy waits for room in the buffer" default:"1s"`
+
+	AuthConfig     string `type:"existingfile" help:"JSON file of credentials and their scopes"`
+	InsecureNoAuth bool   `help:"allow anyone to use the API without credentials when --auth-config is not set"`
+
+	Limit struct {
+		Rate                float64 `help:"events requests per second allowed for each client, unlimited when 0"`
+		Burst               int     `help:"events requests allowed at once for each client, defaults to the rate"`
+		MaxBodySize         int64   `help:"bytes allowed in a request body, unlimited when 0" default:"1048576"`
+		MaxDecompressedSize int64   `help:"bytes allowed in a gzip or zstd request body once decompressed, unlimited when 0" default:"8388608"`
+		MaxLabels           int     `help:"labels allowed on an event, unlimited when 0" default:"64"`
+		MaxLabelSize        int     `help:"bytes allowed in a label's name and value, unlimited when 0" default:"1024"`
+	} `embed:"" prefix:"limit-" group:"limit"`
+
+	Query struct {
+		Timeout      time.Duration `help:"stop a query that runs longer, unlimited when 0" default:"1m"`
+		MaxRows      int64         `help:"rows a query can return, unlimited when 0" default:"100000"`
+		MaxBytes     int64         `help:"bytes of values a query can return, unlimited when 0" default:"67108864"`
+		MaxFiles     int           `help:"files a query can read, unlimited when 0" default:"1000"`
+		MaxLoadBytes int64         `help:"bytes of events a query can load from the files it reads, unlimited when 0" default:"268435456"`
+		Concurrency  int           `help:"files downloaded at once by a query" default:"4"`
+		JobTimeout   time.Duration `help:"stop a background query job that runs longer, unlimited when 0" default:"1h"`
+		JobTTL       time.Duration `name:"job-ttl" help:"how long the results of a background query job are kept, forever when 0" default:"24h"`
+		MaxJobs      int           `help:"background query jobs running at once, unlimited when 0" default:"4"`
+		CacheSize    int64         `help:"bytes of downloaded files kept for later queries, disabled when 0" default:"1073741824"`
+	} `embed:"" prefix:"query-" group:"query"`
+
+	TLS struct {
+		Cert              string `type:"existingfile" help:"certificate file to serve HTTPS, reloaded when it changes"`
+		Key               string `type:"existingfile" help:"private key file for the certificate"`
+		ClientCA          string `type:"existingfile" help:"CA file to verify client certificates with"`
+		RequireClientCert bool   `help:"reject connections without a client certificate signed by the client CA"`
+	} `embed:"" prefix:"tls-" group:"tls"`
+}
+
+func (cmd *ServerCmd) Run(logger *zap.Logger) error {
+	startedAt := time.Now()
+	persistence := cmd.persistence(logger)
+
+	authenticators, err := cmd.authenticators(logger)
+	if err != nil {
+		return err
+	}
+
+	writer, err := services.NewSwitcher(
+		cmd.WorkPath,
+		cmd.FlushSize,
+		cmd.BufferSize,
+		services.Overflow{
+			Policy:  services.OverflowPolicy(cmd.OverflowPolicy),
+			Timeout: cmd.OverflowTimeout,
+		},
+		persistence,
+		logger,
+	)
+	if err != nil {
+		return fmt.Errorf("could not create switcher: %w", err)
+	}
+
+	e := echo.New()
+	e.Use(server.ZapLogger(logger))
+
+	authenticate := server.Authenticate(authenticators...)
+	limiter := server.NewLimiter(server.Limits{
+		Rate:                cmd.Limit.Rate,
+		Burst:               cmd.Limit.Burst,
+		MaxBodySize:         cmd.Limit.MaxBodySize,
+		MaxDecompressedSize: cmd.Limit.MaxDecompressedSize,
+		MaxLabels:           cmd.Limit.MaxLabels,
+		MaxLabelSize:        cmd.Limit.MaxLabelSize,
+	})
+
+	e.GET("/ping", server.Liveness())
+	e.GET("/healthz", server.Liveness())
+	e.GET("/readyz", server.Readiness(
+		server.HealthCheck{Name: "work_path", Check: func() error {
+			return services.CheckWritable(cmd.WorkPath)
+		}},
+		server.HealthCheck{Name: "writer", Check: writer.CheckWriter},
+		server.HealthCheck{Name: "bucket", Check: persistence.CheckRemote},
+		server.HealthCheck{Name: "finalize_queue", Check: func() error {
+			return writer.CheckPending(cmd.ReadyMaxPending)
+		}},
+	))
+
+	e.PUT("/api/events", func(c echo.Context) error {
+		event := &sdk.Event{}
+
+		err := c.Bind(event)
+		if errors.Is(err, server.ErrBodyTooLarge) {
+			//nolint: wrapcheck
+			return c.NoContent(http.StatusRequestEntityTooLarge)
+		}
+
+		if err != nil {
+			logger.Error("could not parse event JSON", zap.Error(err))
+
+			//nolint: wrapcheck
+			return c.NoContent(http.StatusUnprocessableEntity)
+		}
+
+		err = limiter.CheckLabels(event.Labels)
+		if err != nil {
+			//nolint: wrapcheck
+			return c.String(http.StatusRequestEntityTooLarge, err.Error())
+		}
+
+		err = writer.Insert(event)
+		if err != nil {
+			c.Response().Header().Set("Retry-After", "1")
+
+			if errors.Is(err, services.ErrBufferTimeout) {
+				//nolint: wrapcheck
+				return c.NoContent(http.StatusServiceUnavailable)
+			}
+
+			//nolint: wrapcheck
+			return c.NoContent(http.StatusTooManyRequests)
+		}
+
+		//nolint: wrapcheck
+		return c.NoContent(http.StatusCreated)
+	}, limiter.BodyLimit(), authenticate, limiter.RateLimit(), server.RequireScope(server.ScopeWrite), limiter.Decompress())
+
+	limits := services.QueryLimits{
+		Timeout:      cmd.Query.Timeout,
+		MaxRows:      cmd.Query.MaxRows,
+		MaxBytes:     cmd.Query.MaxBytes,
+		MaxFiles:     cmd.Query.MaxFiles,
+		MaxLoadBytes: cmd.Query.MaxLoadBytes,
+		Concurrency:  cmd.Query.Concurrency,
+	}
+
+	var cache *services.FileCache
+
+	if cmd.Query.CacheSize > 0 {
+		cache, err = services.NewFileCache(filepath.Join(cmd.WorkPath, "cache"), cmd.Query.CacheSize, logger)
+		if err != nil {
+			return fmt.Errorf("could not create query cache: %w", err)
+		}
+	}
+
+	reader := services.NewReader(persistence, cmd.WorkPath, logger)
+	reader.IncludeLocal(writer)
+	reader.SetLimits(limits)
+	reader.UseCache(cache)
+	query := queryEvents(reader, logger)
+
+	e.GET("/api/events/query", query, limiter.BodyLimit(), authenticate, server.RequireScope(server.ScopeQuery), limiter.Decompress())
+	e.POST("/api/events/query", query, limiter.BodyLimit(), authenticate, server.RequireScope(server.ScopeQuery), limiter.Decompress())
+
+	// background jobs have longer to run than a request
+	limits.Timeout = cmd.Query.JobTimeout
+	jobReader := services.NewReader(persistence, cmd.WorkPath, logger)
+	jobReader.IncludeLocal(writer)
+	jobReader.SetLimits(limits)
+	jobReader.UseCache(cache)
+
+	jobs, err := services.NewJobs(jobReader, filepath.Join(cmd.WorkPath, "queries"), cmd.Query.JobTTL, cmd.Query.MaxJobs, logger)
+	if err != nil {
+		return fmt.Errorf("could not create query jobs: %w", err)
+	}
+	defer jobs.Close()
+
+	queryJobs := &queryJobs{jobs: jobs, logger: logger}
+
+	e.POST("/api/queries", queryJobs.submit, limiter.BodyLimit(), authenticate, server.RequireScope(server.ScopeQuery), limiter.Decompress())
+	e.GET("/api/queries/:id", queryJobs.status, authenticate, server.RequireScope(server.ScopeQuery))
+	e.GET("/api/queries/:id/results", queryJobs.results, authenticate, server.RequireScope(server.ScopeQuery))
+	e.DELETE("/api/queries/:id", queryJobs.cancel, authenticate, server.RequireScope(server.ScopeQuery))
+
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()), authenticate, server.RequireScope(server.ScopeAdmin))
+
+	e.GET("/api/stats", func(c echo.Context) error {
+		//nolint: wrapcheck
+		return c.JSON(http.StatusOK, statsPayload(startedAt, writer, persistence, limiter))
+	}, authenticate, server.RequireScope(server.ScopeAdmin))
+
+	httpServer, err := cmd.httpServer(logger)
+	if err != nil {
+		return err
+	}
+
+	e.Logger.Fatal(e.StartServer(httpServer))
+
+	return nil
+}
+
+// httpServer serves HTTPS, with HTTP/2, when a certificate is configured.
+func (cmd *ServerCmd) httpServer(logger *zap.Logger) (*http.Server, error) {
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cmd.Port),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	if cmd.TLS.Cert == "" && cmd.TLS.Key == "" {
+		return httpServer, nil
+	}
+
+	if cmd.TLS.Cert == "" || cmd.TLS.Key == "" {
+		return nil, errors.New("both --tls-cert and --tls-key are required for TLS")
+	}
+
+	reloader, err := server.NewCertificateReloader(cmd.TLS.Cert, cmd.TLS.Key, logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+
+	httpServer.TLSConfig, err = server.TLSConfig(reloader, cmd.TLS.ClientCA, cmd.TLS.RequireClientCert)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure TLS: %w", err)
+	}
+
+	err = http2.ConfigureServer(httpServer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure HTTP/2: %w", err)
+	}
+
+	return httpServer, nil
+}
+
+func (cmd *ServerCmd) authenticators(logger *zap.Logger) ([]server.Authenticator, error) {
+	if cmd.AuthConfig == "" {
+		if !cmd.InsecureNoAuth {
+			return nil, fmt.Errorf("%w: set --auth-config, or --insecure-no-auth to allow anyone", server.ErrNoCredentialsConfigured)
+		}
+
+		logger.Warn("the API is open to anyone, as --insecure-no-auth is set")
+
+		return nil, nil
+	}
+
+	config, err := server.LoadAuthConfig(cmd.AuthConfig)
+	if err != nil {
+		return nil, fmt.Errorf("could not load auth: %w", err)
+	}
+
+	config.MaxBodySize = cmd.Limit.MaxBodySize
+
+	authenticators, err := config.Authenticators()
+	if err != nil {
+		return nil, fmt.Errorf("could not configure auth: %w", err)
+	}
+
+	return authenticators, nil
+}
+
+// queryEvents streams the rows of a query, stopping when the client disconnects.
+func queryEvents(reader *services.Reader, logger *zap.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := &sdk.QueryRequest{}
+
+		err := c.Bind(request)
+		if errors.Is(err, server.ErrBodyTooLarge) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "query body is too large")
+		}
+
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "could not parse query JSON")
+		}
+
+		timeRange, err := services.NewTimeRange(request.Range.Start, request.Range.End)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		plan, err := reader.Plan(request.Query, timeRange)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		c.Response().Header().Set(sdk.FilesScannedHeader, strconv.Itoa(len(plan.Files)+len(plan.Local)))
+		c.Response().Header().Set(sdk.FilesSkippedHeader, strconv.Itoa(plan.Skipped))
+
+		return streamRows(c, logger, func(fn services.RowFunc) error {
+			return reader.Execute(c.Request().Context(), plan, request.Query, fn)
+		})
+	}
+}
+
+// streamRows writes rows in the format negotiated with the Accept header.
+// Errors are only reported with a status code until the first row is sent,
+// after that they are set in the X-Query-Error trailer.
+func streamRows(c echo.Context, logger *zap.Logger, query func(services.RowFunc) error) error {
+	mediaType := server.NegotiateFormat(c.Request().Header.Get(echo.HeaderAccept))
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, mediaType)
+	response.Header().Set("Trailer", server.QueryErrorTrailer)
+
+	rows := server.NewRowWriter(mediaType, response)
+
+	err := query(rows.WriteRow)
+	if err == nil {
+		err = rows.Close()
+	}
+
+	if errors.Is(err, context.Canceled) {
+		logger.Info("query cancelled by client", zap.Error(err))
+
+		return nil
+	}
+
+	if err != nil {
+		logger.Error("could not query", zap.Error(err))
+
+		if !response.Committed {
+			response.Header().Del(echo.HeaderContentType)
+			response.Header().Del("Trailer")
+
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				return echo.NewHTTPError(http.StatusGatewayTimeout, err.Error())
+			case isRefusedQuery(err):
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			default:
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+		}
+
+		response.Header().Set(server.QueryErrorTrailer, err.Error())
+	}
+
+	return nil
+}
+
+// isRefusedQuery is when the query itself is at fault, rather than the
+// server failing to read the files it needs.
+func isRefusedQuery(err error) bool {
+	for _, refused := range []error{
+		services.ErrNotAllowed,
+		services.ErrMultipleStatements,
+		services.ErrFunctionArguments,
+		services.ErrQueryLimit,
+	} {
+		if errors.Is(err, refused) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func statsPayload(
+	startedAt time.Time,
+	switcher *services.Switcher,
+	persistence *services.Persistence,
+	limiter *server.Limiter,
+) sdk.StatsPayload {
+	switcherStats := switcher.Stats()
+	persistenceStats := persistence.Stats()
+	limitStats := limiter.Stats()
+
+	stats := sdk.StatsPayload{}
+	stats.Count.Insert = switcherStats.Accepted
+	stats.Count.Written = switcherStats.Written
+	stats.Count.Persisted = persistenceStats.Persisted
+	stats.Count.Dropped = switcherStats.Dropped
+	stats.Count.Rejected = switcherStats.Rejected
+	stats.Count.DroppedLabels = switcherStats.DroppedLabels
+	stats.Writer.Filename = filepath.Base(switcherStats.WriterFilename)
+	stats.Writer.Rows = switcherStats.WriterRows
+	stats.Finalize.Pending = switcherStats.Pending
+	stats.Upload.LastSuccess = persistenceStats.LastUpload
+	stats.Upload.Errors = persistenceStats.UploadErrors
+	stats.Buffer.Capacity = switcherStats.BufferCapacity
+	stats.Buffer.Usage = switcherStats.BufferUsage
+	stats.Limits.RateLimited = limitStats.RateLimited
+	stats.Limits.TooLarge = limitStats.TooLarge
+	stats.Uptime.Seconds = time.Since(startedAt).Seconds()
+
+	return stats
+}
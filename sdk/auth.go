@@ -0,0 +1,94 @@
+package sdk
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+const (
+	// HMACScheme is the Authorization scheme of signed requests.
+	HMACScheme = "HMAC-SHA256"
+	// TimestampHeader holds the unix seconds a request was signed at.
+	TimestampHeader = "X-Timestamp"
+)
+
+// WithBearerToken sends a static token with every request.
+func WithBearerToken(token string) Option {
+	return func(c *Client) error {
+		c.client.SetCommonBearerAuthToken(token)
+
+		return nil
+	}
+}
+
+// WithHMAC signs every request with a shared secret.
+func WithHMAC(keyID string, secret []byte) Option {
+	return func(c *Client) error {
+		c.client.WrapRoundTripFunc(func(rt req.RoundTripper) req.RoundTripFunc {
+			return func(r *req.Request) (*req.Response, error) {
+				timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+				signature := Sign(secret, r.Method, r.URL.RequestURI(), timestamp, r.Body)
+
+				r.SetHeader(TimestampHeader, timestamp)
+				r.SetHeader("Authorization", fmt.Sprintf("%s keyId=%s, signature=%s", HMACScheme, keyID, signature))
+
+				//nolint: wrapcheck
+				return rt.RoundTrip(r)
+			}
+		})
+
+		return nil
+	}
+}
+
+// WithClientCertificate presents a certificate to servers that verify clients.
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(c *Client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("could not load client certificate: %w", err)
+		}
+
+		c.client.SetCerts(cert)
+
+		return nil
+	}
+}
+
+// WithRootCA trusts the certificates in a PEM file, for servers with a private CA.
+func WithRootCA(filename string) Option {
+	return func(c *Client) error {
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("could not read root CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(contents) {
+			return fmt.Errorf("no certificates found in %q", filename)
+		}
+
+		c.client.GetTLSClientConfig().RootCAs = pool
+
+		return nil
+	}
+}
+
+// Sign is the HMAC-SHA256 of a request's method, URI, timestamp and body digest.
+func Sign(secret []byte, method, uri, timestamp string, body []byte) string {
+	digest := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, uri, timestamp, hex.EncodeToString(digest[:]))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
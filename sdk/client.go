@@ -2,24 +2,88 @@ package sdk
 
 import (
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/imroc/req/v3"
 )
 
+const (
+	retryCount       = 3
+	retryMinInterval = 100 * time.Millisecond
+	retryMaxInterval = 10 * time.Second
+)
+
 type Client struct {
-	client   *req.Client
-	endpoint string
+	client       *req.Client
+	compression  compression
+	endpoint     string
+	pollInterval time.Duration
 }
 
-func New(host string) (*Client, error) {
+// Option configures a Client, such as with credentials.
+type Option func(*Client) error
+
+func New(host string, options ...Option) (*Client, error) {
 	uri, err := url.Parse(host)
 	if err != nil {
 		return nil, fmt.Errorf("invalid host provided: %w", err)
 	}
 
-	return &Client{
-		client:   req.C(),
-		endpoint: uri.String(),
-	}, nil
+	client := req.C().
+		SetCommonRetryCount(retryCount).
+		SetCommonRetryCondition(isSaturated).
+		SetCommonRetryInterval(retryAfter)
+
+	c := &Client{
+		client:       client,
+		compression:  compression{encoding: EncodingGzip, threshold: defaultCompressionThreshold},
+		endpoint:     uri.String(),
+		pollInterval: defaultPollInterval,
+	}
+
+	for _, option := range options {
+		err = option(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// added last so it runs first, and requests are signed once compressed
+	client.WrapRoundTripFunc(c.compression.compress)
+
+	return c, nil
+}
+
+// isSaturated is when the server asks to slow down, so the request can be retried.
+func isSaturated(response *req.Response, err error) bool {
+	if err != nil || response.Response == nil {
+		return false
+	}
+
+	return response.StatusCode == http.StatusTooManyRequests ||
+		response.StatusCode == http.StatusServiceUnavailable
+}
+
+// retryAfter waits as long as the server's Retry-After header asks,
+// otherwise backing off exponentially.
+func retryAfter(response *req.Response, attempt int) time.Duration {
+	if response != nil && response.Response != nil {
+		seconds, err := strconv.Atoi(response.Header.Get("Retry-After"))
+		if err == nil && seconds >= 0 {
+			return minDuration(time.Duration(seconds)*time.Second, retryMaxInterval)
+		}
+	}
+
+	return minDuration(retryMinInterval<<attempt, retryMaxInterval)
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+
+	return b
 }
@@ -0,0 +1,90 @@
+package sdk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/imroc/req/v3"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoding is the Content-Encoding used to compress request bodies.
+type Encoding string
+
+const (
+	EncodingNone Encoding = ""
+	EncodingGzip Encoding = "gzip"
+	EncodingZstd Encoding = "zstd"
+)
+
+const defaultCompressionThreshold = 4096
+
+// WithCompression compresses request bodies of at least threshold bytes.
+// Bodies are compressed with gzip above 4KiB by default, and EncodingNone disables it.
+func WithCompression(encoding Encoding, threshold int) Option {
+	return func(c *Client) error {
+		switch encoding {
+		case EncodingNone, EncodingGzip, EncodingZstd:
+		default:
+			return fmt.Errorf("unsupported encoding %q", encoding)
+		}
+
+		c.compression = compression{encoding: encoding, threshold: threshold}
+
+		return nil
+	}
+}
+
+type compression struct {
+	encoding  Encoding
+	threshold int
+}
+
+func (c compression) compress(rt req.RoundTripper) req.RoundTripFunc {
+	return func(r *req.Request) (*req.Response, error) {
+		// retried requests have already been compressed
+		if c.encoding == EncodingNone || len(r.Body) < c.threshold || r.Headers.Get("Content-Encoding") != "" {
+			//nolint: wrapcheck
+			return rt.RoundTrip(r)
+		}
+
+		body, err := c.encode(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		r.SetBodyBytes(body)
+		r.SetHeader("Content-Encoding", string(c.encoding))
+
+		//nolint: wrapcheck
+		return rt.RoundTrip(r)
+	}
+}
+
+func (c compression) encode(body []byte) ([]byte, error) {
+	if c.encoding == EncodingZstd {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not create zstd encoder: %w", err)
+		}
+		defer encoder.Close()
+
+		return encoder.EncodeAll(body, nil), nil
+	}
+
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+
+	_, err := writer.Write(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not gzip body: %w", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not gzip body: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
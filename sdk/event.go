@@ -1,10 +1,15 @@
 package sdk
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 )
 
+// ErrSaturated is returned when the server is still refusing events after retrying.
+var ErrSaturated = errors.New("server is saturated, try again later")
+
 type Labels map[string]string
 type Time uint64
 type Value string
@@ -15,10 +20,11 @@ type Event struct {
 	Value  Value  `json:"value"`
 }
 
-func (c *Client) SendEvent(event Event) error {
+func (c *Client) SendEvent(ctx context.Context, event Event) error {
 	client := c.client
 
 	response, err := client.R().
+		SetContext(ctx).
 		SetBodyJsonMarshal(event).
 		Put(fmt.Sprintf("%s/api/events", c.endpoint))
 	if err != nil {
@@ -29,5 +35,9 @@ func (c *Client) SendEvent(event Event) error {
 		return nil
 	}
 
+	if isSaturated(response, nil) {
+		return fmt.Errorf("could not PUT /api/events: %w", ErrSaturated)
+	}
+
 	return fmt.Errorf("the PUT to /api/events failed")
 }
@@ -0,0 +1,180 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrQueryJobsUnsupported is returned by SubmitQuery when the server cannot run queries in the background.
+var ErrQueryJobsUnsupported = errors.New("the server does not support query jobs")
+
+const defaultPollInterval = 500 * time.Millisecond
+
+// QueryJobStatus is where a query job is in its life.
+type QueryJobStatus string
+
+const (
+	QueryJobRunning   QueryJobStatus = "running"
+	QueryJobSucceeded QueryJobStatus = "succeeded"
+	QueryJobFailed    QueryJobStatus = "failed"
+	QueryJobCancelled QueryJobStatus = "cancelled"
+)
+
+// QueryJob is a query run in the background by the server.
+type QueryJob struct {
+	ID         string         `json:"id"`
+	Query      string         `json:"query"`
+	Status     QueryJobStatus `json:"status"`
+	FilesDone  int            `json:"files_done"`
+	FilesTotal int            `json:"files_total"`
+	Rows       int64          `json:"rows"`
+	Error      string         `json:"error,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// Finished is true once the job has stopped, with or without results.
+func (j *QueryJob) Finished() bool {
+	return j.Status != QueryJobRunning
+}
+
+// WithPollInterval sets how often WaitQuery checks on a job.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) error {
+		c.pollInterval = interval
+
+		return nil
+	}
+}
+
+// SubmitQuery starts a query in the background, to be polled with QueryJob.
+func (c *Client) SubmitQuery(ctx context.Context, query string, start, end time.Time) (*QueryJob, error) {
+	job := &QueryJob{}
+
+	response, err := c.client.R().
+		SetContext(ctx).
+		SetBodyJsonMarshal(NewQueryRequest(query, start, end)).
+		SetSuccessResult(job).
+		Post(fmt.Sprintf("%s/api/queries", c.endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not POST /api/queries: %w", err)
+	}
+
+	switch response.StatusCode {
+	case http.StatusAccepted:
+		return job, nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return nil, ErrQueryJobsUnsupported
+	default:
+		return nil, fmt.Errorf("the POST to /api/queries failed with %d: %s", response.StatusCode, errorMessage(response.Bytes()))
+	}
+}
+
+// QueryJob returns the status and progress of a job.
+func (c *Client) QueryJob(ctx context.Context, id string) (*QueryJob, error) {
+	job := &QueryJob{}
+
+	response, err := c.client.R().
+		SetContext(ctx).
+		SetPathParam("id", id).
+		SetSuccessResult(job).
+		Get(fmt.Sprintf("%s/api/queries/{id}", c.endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not GET /api/queries/%s: %w", id, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the GET of /api/queries/%s failed with %d: %s", id, response.StatusCode, errorMessage(response.Bytes()))
+	}
+
+	return job, nil
+}
+
+// WaitQuery polls the job until it has finished, returning its final status.
+func (c *Client) WaitQuery(ctx context.Context, id string) (*QueryJob, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.QueryJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if job.Finished() {
+			return job, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for query job %s: %w", id, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// QueryInBackground runs the query as a job, so it can take longer than a
+// request, returning its rows once it has succeeded. The job is cancelled
+// when ctx is done first. Servers without query jobs run it with Query.
+func (c *Client) QueryInBackground(ctx context.Context, query string, start, end time.Time) (*Rows, error) {
+	job, err := c.SubmitQuery(ctx, query, start, end)
+	if errors.Is(err, ErrQueryJobsUnsupported) {
+		return c.Query(ctx, query, start, end)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := job.ID
+
+	job, err = c.WaitQuery(ctx, id)
+	if err != nil {
+		if ctx.Err() != nil {
+			_ = c.CancelQuery(context.Background(), id)
+		}
+
+		return nil, err
+	}
+
+	if job.Status != QueryJobSucceeded {
+		return nil, fmt.Errorf("query job %s %s: %s", job.ID, job.Status, job.Error)
+	}
+
+	return c.QueryResults(ctx, job.ID)
+}
+
+// QueryResults streams the rows of a succeeded job.
+func (c *Client) QueryResults(ctx context.Context, id string) (*Rows, error) {
+	response, err := c.client.R().
+		SetContext(ctx).
+		SetPathParam("id", id).
+		SetHeader("Accept", "application/x-ndjson").
+		DisableAutoReadResponse().
+		Get(fmt.Sprintf("%s/api/queries/{id}/results", c.endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not GET /api/queries/%s/results: %w", id, err)
+	}
+
+	return newRows(response.Response, fmt.Sprintf("the GET of /api/queries/%s/results", id))
+}
+
+// CancelQuery stops a running job, or removes a finished one and its results.
+func (c *Client) CancelQuery(ctx context.Context, id string) error {
+	response, err := c.client.R().
+		SetContext(ctx).
+		SetPathParam("id", id).
+		Delete(fmt.Sprintf("%s/api/queries/{id}", c.endpoint))
+	if err != nil {
+		return fmt.Errorf("could not DELETE /api/queries/%s: %w", id, err)
+	}
+
+	if response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("the DELETE of /api/queries/%s failed with %d: %s", id, response.StatusCode, errorMessage(response.Bytes()))
+	}
+
+	return nil
+}
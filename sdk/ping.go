@@ -1,17 +1,32 @@
 package sdk
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 )
 
-func (c *Client) Ping() (bool, error) {
+const HealthOK = "ok"
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthPayload struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// Ping reports whether the server is alive.
+func (c *Client) Ping(ctx context.Context) (bool, error) {
 	client := c.client
 
 	response, err := client.R().
-		Get(fmt.Sprintf("%s/ping", c.endpoint))
+		SetContext(ctx).
+		Get(fmt.Sprintf("%s/healthz", c.endpoint))
 	if err != nil {
-		return false, fmt.Errorf("could not GET /ping: %w", err)
+		return false, fmt.Errorf("could not GET /healthz: %w", err)
 	}
 
 	if response.StatusCode == http.StatusOK {
@@ -20,3 +35,41 @@ func (c *Client) Ping() (bool, error) {
 
 	return false, nil
 }
+
+// Ready reports whether the server is ready to accept events, see Readiness.
+func (c *Client) Ready(ctx context.Context) (bool, error) {
+	payload, err := c.Readiness(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return payload != nil && payload.Status == HealthOK, nil
+}
+
+// Readiness returns the result of each of the server's readiness checks.
+// A nil payload is returned for responses that are not a readiness report.
+func (c *Client) Readiness(ctx context.Context) (*HealthPayload, error) {
+	payload := &HealthPayload{}
+
+	client := c.client
+
+	// not ready is an answer, rather than a reason to retry
+	response, err := client.R().
+		SetContext(ctx).
+		SetRetryCount(0).
+		Get(fmt.Sprintf("%s/readyz", c.endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not GET /readyz: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusServiceUnavailable {
+		return nil, nil
+	}
+
+	err = response.UnmarshalJson(payload)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse /readyz: %w", err)
+	}
+
+	return payload, nil
+}
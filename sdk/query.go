@@ -0,0 +1,187 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// FilesScannedHeader is the number of files a query reads.
+	FilesScannedHeader = "X-Files-Scanned"
+	// FilesSkippedHeader is the number of files pruned from a query by time range or labels.
+	FilesSkippedHeader = "X-Files-Skipped"
+)
+
+// QueryRange bounds a query by event time, as RFC3339, a date, or unix nanoseconds.
+// An empty Start or End is unbounded.
+type QueryRange struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type QueryRequest struct {
+	Query string     `json:"query"`
+	Range QueryRange `json:"range"`
+}
+
+// Rows iterates over the rows of a query as the server streams them.
+// It must be closed when done with.
+type Rows struct {
+	current  json.RawMessage
+	decoder  *json.Decoder
+	err      error
+	response *http.Response
+}
+
+// Query runs SQL against the events from start to end, returning the rows as
+// they are streamed. A zero start or end is unbounded.
+func (c *Client) Query(ctx context.Context, query string, start, end time.Time) (*Rows, error) {
+	response, err := c.client.R().
+		SetContext(ctx).
+		SetBodyJsonMarshal(NewQueryRequest(query, start, end)).
+		SetHeader("Accept", "application/x-ndjson").
+		DisableAutoReadResponse().
+		Post(fmt.Sprintf("%s/api/events/query", c.endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("could not POST /api/events/query: %w", err)
+	}
+
+	return newRows(response.Response, "the POST to /api/events/query")
+}
+
+// NewQueryRequest bounds the query by times in unix nanoseconds, leaving zero times unbounded.
+func NewQueryRequest(query string, start, end time.Time) QueryRequest {
+	request := QueryRequest{Query: query}
+
+	if !start.IsZero() {
+		request.Range.Start = strconv.FormatInt(start.UnixNano(), 10)
+	}
+
+	if !end.IsZero() {
+		request.Range.End = strconv.FormatInt(end.UnixNano(), 10)
+	}
+
+	return request
+}
+
+// newRows streams the rows of a successful response, otherwise returning its error.
+func newRows(response *http.Response, request string) (*Rows, error) {
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+
+		return nil, fmt.Errorf("%s failed with %d: %s", request, response.StatusCode, errorMessage(body))
+	}
+
+	return &Rows{
+		decoder:  json.NewDecoder(response.Body),
+		response: response,
+	}, nil
+}
+
+// errorMessage is the message of an echo error response.
+func errorMessage(body []byte) string {
+	message := struct {
+		Message string `json:"message"`
+	}{}
+	_ = json.Unmarshal(body, &message)
+
+	return message.Message
+}
+
+// Next advances to the next row, returning false at the end of the rows or on an error.
+func (r *Rows) Next() bool {
+	if r.err != nil {
+		return false
+	}
+
+	r.current = nil
+
+	err := r.decoder.Decode(&r.current)
+	if errors.Is(err, io.EOF) {
+		// the server reports errors after rows have been sent in a trailer
+		if message := r.response.Trailer.Get("X-Query-Error"); message != "" {
+			r.err = fmt.Errorf("query failed: %s", message)
+		}
+
+		return false
+	}
+
+	if err != nil {
+		r.err = fmt.Errorf("could not read row: %w", err)
+
+		return false
+	}
+
+	return true
+}
+
+// Scan decodes the current row, an object of column names to values, into dest.
+func (r *Rows) Scan(dest any) error {
+	err := json.Unmarshal(r.current, dest)
+	if err != nil {
+		return fmt.Errorf("could not decode row: %w", err)
+	}
+
+	return nil
+}
+
+// CollectRows scans every row into a T, such as a struct with JSON tags for
+// the columns, closing the rows.
+func CollectRows[T any](rows *Rows) ([]T, error) {
+	defer rows.Close()
+
+	results := []T{}
+
+	for rows.Next() {
+		var result T
+
+		err := rows.Scan(&result)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// FilesScanned is the number of files the server reads for the query.
+func (r *Rows) FilesScanned() int {
+	scanned, _ := strconv.Atoi(r.response.Header.Get(FilesScannedHeader))
+
+	return scanned
+}
+
+// FilesSkipped is the number of files the server pruned from the query.
+func (r *Rows) FilesSkipped() int {
+	skipped, _ := strconv.Atoi(r.response.Header.Get(FilesSkippedHeader))
+
+	return skipped
+}
+
+// Err is the error that stopped Next, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+func (r *Rows) Close() error {
+	err := r.response.Body.Close()
+	if err != nil {
+		return fmt.Errorf("could not close rows: %w", err)
+	}
+
+	return nil
+}
@@ -1,9 +1,17 @@
 package sdk_test
 
 import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/klauspost/compress/zstd"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/ghttp"
@@ -38,16 +46,16 @@ var _ = Describe("Client", func() {
 	})
 
 	When("pinging", func() {
-		It("returns false on non-200", func() {
+		It("returns false on unexpected status codes", func() {
 			for _, statusCode := range []int{400, 500} {
 				server.AppendHandlers(
 					ghttp.CombineHandlers(
-						ghttp.VerifyRequest("GET", "/ping"),
+						ghttp.VerifyRequest("GET", "/healthz"),
 						ghttp.RespondWith(statusCode, ``),
 					),
 				)
 
-				ok, err := client.Ping()
+				ok, err := client.Ping(context.Background())
 				Expect(err).NotTo(HaveOccurred())
 				Expect(ok).To(BeFalse())
 			}
@@ -56,23 +64,97 @@ var _ = Describe("Client", func() {
 		It("errors on network issues", func() {
 			server.Close()
 
-			ok, err := client.Ping()
+			ok, err := client.Ping(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("returns true when alive", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/healthz"),
+					ghttp.RespondWith(200, `{"status":"ok"}`),
+				),
+			)
+
+			ok, err := client.Ping(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	When("checking readiness", func() {
+		jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+
+		It("returns false on unexpected status codes", func() {
+			for _, statusCode := range []int{400, 500} {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/readyz"),
+						ghttp.RespondWith(statusCode, ``),
+					),
+				)
+
+				ok, err := client.Ready(context.Background())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
+			}
+		})
+
+		It("errors on network issues", func() {
+			server.Close()
+
+			ok, err := client.Ready(context.Background())
+			Expect(err).To(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("errors on invalid JSON", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/readyz"),
+					ghttp.RespondWith(200, `\* not JSON *\`, jsonHeader),
+				),
+			)
+
+			ok, err := client.Ready(context.Background())
 			Expect(err).To(HaveOccurred())
 			Expect(ok).To(BeFalse())
 		})
 
-		It("returns true on 200", func() {
+		It("returns true when ready", func() {
 			server.AppendHandlers(
 				ghttp.CombineHandlers(
-					ghttp.VerifyRequest("GET", "/ping"),
-					ghttp.RespondWith(200, ``),
+					ghttp.VerifyRequest("GET", "/readyz"),
+					ghttp.RespondWith(200, `{"status":"ok","checks":{"writer":{"status":"ok"}}}`, jsonHeader),
 				),
 			)
 
-			ok, err := client.Ping()
+			ok, err := client.Ready(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(ok).To(BeTrue())
 		})
+
+		It("returns the failed checks when not ready", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/readyz"),
+					ghttp.RespondWith(503, `{
+						"status": "failed",
+						"checks": {
+							"writer": {"status": "ok"},
+							"bucket": {"status": "failed", "error": "unreachable"}
+						}
+					}`, jsonHeader),
+				),
+			)
+
+			payload, err := client.Readiness(context.Background())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(payload.Status).To(Equal("failed"))
+			Expect(payload.Checks).To(HaveKeyWithValue("bucket", sdk.HealthCheck{Status: "failed", Error: "unreachable"}))
+			Expect(payload.Checks).To(HaveKeyWithValue("writer", sdk.HealthCheck{Status: "ok"}))
+		})
 	})
 
 	When("submitting an event", func() {
@@ -85,7 +167,7 @@ var _ = Describe("Client", func() {
 					),
 				)
 
-				err := client.SendEvent(sdk.Event{})
+				err := client.SendEvent(context.Background(), sdk.Event{})
 				Expect(err).To(HaveOccurred())
 			}
 		})
@@ -93,7 +175,7 @@ var _ = Describe("Client", func() {
 		It("errors on network issues", func() {
 			server.Close()
 
-			err := client.SendEvent(sdk.Event{})
+			err := client.SendEvent(context.Background(), sdk.Event{})
 			Expect(err).To(HaveOccurred())
 		})
 
@@ -105,9 +187,469 @@ var _ = Describe("Client", func() {
 				),
 			)
 
-			err := client.SendEvent(sdk.Event{})
+			err := client.SendEvent(context.Background(), sdk.Event{})
 			Expect(err).NotTo(HaveOccurred())
 		})
+
+		It("retries when the server is saturated", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.RespondWith(429, ``, http.Header{"Retry-After": []string{"0"}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.RespondWith(503, ``, http.Header{"Retry-After": []string{"0"}}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.RespondWith(201, ``),
+				),
+			)
+
+			err := client.SendEvent(context.Background(), sdk.Event{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("returns an error when the server stays saturated", func() {
+			for i := 0; i < 4; i++ {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PUT", "/api/events"),
+						ghttp.RespondWith(429, ``, http.Header{"Retry-After": []string{"0"}}),
+					),
+				)
+			}
+
+			err := client.SendEvent(context.Background(), sdk.Event{})
+			Expect(err).To(MatchError(sdk.ErrSaturated))
+			Expect(server.ReceivedRequests()).To(HaveLen(4))
+		})
+	})
+
+	When("using credentials", func() {
+		It("sends a bearer token", func() {
+			client, err := sdk.New(server.URL(), sdk.WithBearerToken("token"))
+			Expect(err).NotTo(HaveOccurred())
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.VerifyHeaderKV("Authorization", "Bearer token"),
+					ghttp.RespondWith(201, ``),
+				),
+			)
+
+			err = client.SendEvent(context.Background(), sdk.Event{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("signs requests with HMAC", func() {
+			secret := []byte("secret")
+
+			client, err := sdk.New(server.URL(), sdk.WithHMAC("key", secret))
+			Expect(err).NotTo(HaveOccurred())
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					func(w http.ResponseWriter, r *http.Request) {
+						body, err := io.ReadAll(r.Body)
+						Expect(err).NotTo(HaveOccurred())
+
+						timestamp := r.Header.Get(sdk.TimestampHeader)
+						Expect(timestamp).NotTo(BeEmpty())
+
+						signature := sdk.Sign(secret, "PUT", "/api/events", timestamp, body)
+						Expect(r.Header.Get("Authorization")).To(Equal(
+							fmt.Sprintf("%s keyId=key, signature=%s", sdk.HMACScheme, signature),
+						))
+					},
+					ghttp.RespondWith(201, ``),
+				),
+			)
+
+			err = client.SendEvent(context.Background(), sdk.Event{Value: "signed"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("errors on a missing client certificate", func() {
+			_, err := sdk.New(server.URL(), sdk.WithClientCertificate("missing.pem", "missing.key"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("errors on a missing root CA", func() {
+			_, err := sdk.New(server.URL(), sdk.WithRootCA("missing.pem"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("compressing requests", func() {
+		decompressed := func(r *http.Request) string {
+			var (
+				reader io.Reader
+				err    error
+			)
+
+			switch r.Header.Get("Content-Encoding") {
+			case "gzip":
+				reader, err = gzip.NewReader(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+			case "zstd":
+				reader, err = zstd.NewReader(r.Body)
+				Expect(err).NotTo(HaveOccurred())
+			default:
+				reader = r.Body
+			}
+
+			body, err := io.ReadAll(reader)
+			Expect(err).NotTo(HaveOccurred())
+
+			return string(body)
+		}
+
+		expectEncoding := func(encoding string, value string) {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					func(w http.ResponseWriter, r *http.Request) {
+						Expect(r.Header.Get("Content-Encoding")).To(Equal(encoding))
+						Expect(decompressed(r)).To(ContainSubstring(value))
+					},
+					ghttp.RespondWith(201, ``),
+				),
+			)
+		}
+
+		It("does not compress small bodies", func() {
+			expectEncoding("", "small")
+
+			err := client.SendEvent(context.Background(), sdk.Event{Value: "small"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("compresses large bodies with gzip", func() {
+			value := strings.Repeat("large", 1000)
+			expectEncoding("gzip", value)
+
+			err := client.SendEvent(context.Background(), sdk.Event{Value: sdk.Value(value)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("compresses with zstd over a threshold", func() {
+			client, err := sdk.New(server.URL(), sdk.WithCompression(sdk.EncodingZstd, 10))
+			Expect(err).NotTo(HaveOccurred())
+
+			expectEncoding("zstd", "over ten bytes")
+
+			err = client.SendEvent(context.Background(), sdk.Event{Value: "over ten bytes"})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("compresses once when retrying", func() {
+			value := strings.Repeat("retried", 1000)
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.RespondWith(429, ``, http.Header{"Retry-After": []string{"0"}}),
+				),
+			)
+			expectEncoding("gzip", value)
+
+			err := client.SendEvent(context.Background(), sdk.Event{Value: sdk.Value(value)})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("signs the compressed body", func() {
+			secret := []byte("secret")
+
+			client, err := sdk.New(server.URL(), sdk.WithHMAC("key", secret), sdk.WithCompression(sdk.EncodingGzip, 0))
+			Expect(err).NotTo(HaveOccurred())
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", "/api/events"),
+					ghttp.VerifyHeaderKV("Content-Encoding", "gzip"),
+					func(w http.ResponseWriter, r *http.Request) {
+						body, err := io.ReadAll(r.Body)
+						Expect(err).NotTo(HaveOccurred())
+
+						signature := sdk.Sign(secret, "PUT", "/api/events", r.Header.Get(sdk.TimestampHeader), body)
+						Expect(r.Header.Get("Authorization")).To(HaveSuffix(signature))
+					},
+					ghttp.RespondWith(201, ``),
+				),
+			)
+
+			err = client.SendEvent(context.Background(), sdk.Event{})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("errors on an unsupported encoding", func() {
+			_, err := sdk.New(server.URL(), sdk.WithCompression("br", 0))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	When("querying", func() {
+		type row struct {
+			ID    int    `json:"id"`
+			Value string `json:"value"`
+		}
+
+		query := func() (*sdk.Rows, error) {
+			return client.Query(context.Background(), "SELECT id, value FROM payloads", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{})
+		}
+
+		It("iterates over the streamed rows", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/events/query"),
+					ghttp.VerifyHeaderKV("Accept", "application/x-ndjson"),
+					ghttp.VerifyJSON(`{"query":"SELECT id, value FROM payloads","range":{"start":"1672531200000000000"}}`),
+					ghttp.RespondWith(200, `{"id":1,"value":"a"}`+"\n"+`{"id":2,"value":"b"}`+"\n", http.Header{
+						sdk.FilesScannedHeader: []string{"2"},
+						sdk.FilesSkippedHeader: []string{"3"},
+					}),
+				),
+			)
+
+			rows, err := query()
+			Expect(err).NotTo(HaveOccurred())
+
+			defer rows.Close()
+
+			results := []row{}
+
+			for rows.Next() {
+				result := row{}
+				Expect(rows.Scan(&result)).To(Succeed())
+				results = append(results, result)
+			}
+
+			Expect(rows.Err()).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]row{{1, "a"}, {2, "b"}}))
+			Expect(rows.FilesScanned()).To(Equal(2))
+			Expect(rows.FilesSkipped()).To(Equal(3))
+		})
+
+		It("collects the rows into structs", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(200, `{"id":1,"value":"a"}`+"\n"+`{"id":2,"value":"b"}`+"\n"),
+			)
+
+			rows, err := query()
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := sdk.CollectRows[row](rows)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]row{{1, "a"}, {2, "b"}}))
+		})
+
+		It("stops when the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			_, err := client.Query(ctx, "SELECT 1", time.Time{}, time.Time{})
+			Expect(err).To(MatchError(context.Canceled))
+		})
+
+		It("returns the server's error before rows are sent", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/events/query"),
+					ghttp.RespondWith(400, `{"message":"no such table: nope"}`),
+				),
+			)
+
+			_, err := query()
+			Expect(err).To(MatchError(ContainSubstring("no such table: nope")))
+		})
+
+		It("returns the server's error after rows are sent", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/events/query"),
+					func(w http.ResponseWriter, r *http.Request) {
+						w.Header().Set("Trailer", "X-Query-Error")
+						_, _ = w.Write([]byte(`{"id":1,"value":"a"}` + "\n"))
+						w.Header().Set("X-Query-Error", "could not download")
+					},
+				),
+			)
+
+			rows, err := query()
+			Expect(err).NotTo(HaveOccurred())
+
+			defer rows.Close()
+
+			Expect(rows.Next()).To(BeTrue())
+			Expect(rows.Next()).To(BeFalse())
+			Expect(rows.Err()).To(MatchError(ContainSubstring("could not download")))
+		})
+	})
+
+	When("running query jobs", func() {
+		jsonHeader := http.Header{"Content-Type": []string{"application/json"}}
+
+		It("submits a query and polls its status", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/queries"),
+					ghttp.VerifyJSON(`{"query":"SELECT 1","range":{}}`),
+					ghttp.RespondWith(202, `{"id":"abc","query":"SELECT 1","status":"running","files_done":0,"files_total":2}`, jsonHeader),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/queries/abc"),
+					ghttp.RespondWith(200, `{"id":"abc","status":"succeeded","files_done":2,"files_total":2,"rows":1,"finished_at":"2023-01-01T00:00:00Z"}`, jsonHeader),
+				),
+			)
+
+			job, err := client.SubmitQuery(context.Background(), "SELECT 1", time.Time{}, time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.ID).To(Equal("abc"))
+			Expect(job.FilesTotal).To(Equal(2))
+			Expect(job.Finished()).To(BeFalse())
+
+			job, err = client.QueryJob(context.Background(), "abc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(job.Status).To(Equal(sdk.QueryJobSucceeded))
+			Expect(job.Finished()).To(BeTrue())
+			Expect(*job.FinishedAt).To(Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+		})
+
+		It("streams the results", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/queries/abc/results"),
+					ghttp.VerifyHeaderKV("Accept", "application/x-ndjson"),
+					ghttp.RespondWith(200, `{"total":5}`+"\n"),
+				),
+			)
+
+			rows, err := client.QueryResults(context.Background(), "abc")
+			Expect(err).NotTo(HaveOccurred())
+
+			defer rows.Close()
+
+			result := map[string]int{}
+			Expect(rows.Next()).To(BeTrue())
+			Expect(rows.Scan(&result)).To(Succeed())
+			Expect(result).To(Equal(map[string]int{"total": 5}))
+		})
+
+		It("returns the server's errors", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(404, `{"message":"query job not found"}`),
+				ghttp.RespondWith(409, `{"message":"query job is running"}`),
+				ghttp.RespondWith(400, `{"message":"only a single SQL statement can be run"}`),
+			)
+
+			_, err := client.QueryJob(context.Background(), "nope")
+			Expect(err).To(MatchError(ContainSubstring("query job not found")))
+
+			_, err = client.QueryResults(context.Background(), "abc")
+			Expect(err).To(MatchError(ContainSubstring("query job is running")))
+
+			_, err = client.SubmitQuery(context.Background(), "SELECT 1; SELECT 2", time.Time{}, time.Time{})
+			Expect(err).To(MatchError(ContainSubstring("only a single SQL statement")))
+		})
+
+		It("runs a query in the background until it succeeds", func() {
+			client, err := sdk.New(server.URL(), sdk.WithPollInterval(time.Millisecond))
+			Expect(err).NotTo(HaveOccurred())
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/queries"),
+					ghttp.VerifyJSON(`{"query":"SELECT COUNT(*) AS total FROM payloads","range":{"end":"1672531200000000000"}}`),
+					ghttp.RespondWith(202, `{"id":"abc","status":"running"}`, jsonHeader),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/queries/abc"),
+					ghttp.RespondWith(200, `{"id":"abc","status":"running"}`, jsonHeader),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/queries/abc"),
+					ghttp.RespondWith(200, `{"id":"abc","status":"succeeded"}`, jsonHeader),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/api/queries/abc/results"),
+					ghttp.RespondWith(200, `{"total":5}`+"\n"),
+				),
+			)
+
+			rows, err := client.QueryInBackground(context.Background(), "SELECT COUNT(*) AS total FROM payloads", time.Time{}, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := sdk.CollectRows[map[string]int](rows)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal([]map[string]int{{"total": 5}}))
+		})
+
+		It("returns the error of a failed background query", func() {
+			server.AppendHandlers(
+				ghttp.RespondWith(202, `{"id":"abc","status":"running"}`, jsonHeader),
+				ghttp.RespondWith(200, `{"id":"abc","status":"failed","error":"query limit exceeded"}`, jsonHeader),
+			)
+
+			_, err := client.QueryInBackground(context.Background(), "SELECT 1", time.Time{}, time.Time{})
+			Expect(err).To(MatchError(ContainSubstring("query limit exceeded")))
+		})
+
+		It("cancels a background query when the context is done", func() {
+			client, err := sdk.New(server.URL(), sdk.WithPollInterval(time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			server.AppendHandlers(
+				ghttp.RespondWith(202, `{"id":"abc","status":"running"}`, jsonHeader),
+				ghttp.RespondWith(200, `{"id":"abc","status":"running"}`, jsonHeader),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/api/queries/abc"),
+					ghttp.RespondWith(204, ``),
+				),
+			)
+
+			_, err = client.QueryInBackground(ctx, "SELECT 1", time.Time{}, time.Time{})
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("queries directly when the server has no query jobs", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/queries"),
+					ghttp.RespondWith(404, `{"message":"Not Found"}`),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/api/events/query"),
+					ghttp.RespondWith(200, `{"total":5}`+"\n"),
+				),
+			)
+
+			rows, err := client.QueryInBackground(context.Background(), "SELECT 1", time.Time{}, time.Time{})
+			Expect(err).NotTo(HaveOccurred())
+
+			results, err := sdk.CollectRows[map[string]int](rows)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(HaveLen(1))
+		})
+
+		It("cancels a job", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", "/api/queries/abc"),
+					ghttp.RespondWith(204, ``),
+				),
+			)
+
+			Expect(client.CancelQuery(context.Background(), "abc")).To(Succeed())
+		})
 	})
 
 	When("retrieving stats", func() {
@@ -120,7 +662,7 @@ var _ = Describe("Client", func() {
 					),
 				)
 
-				stats, err := client.Stats()
+				stats, err := client.Stats(context.Background())
 				Expect(err).To(HaveOccurred())
 				Expect(stats).To(BeNil())
 			}
@@ -129,7 +671,7 @@ var _ = Describe("Client", func() {
 		It("errors on network issues", func() {
 			server.Close()
 
-			stats, err := client.Stats()
+			stats, err := client.Stats(context.Background())
 			Expect(err).To(HaveOccurred())
 			Expect(stats).To(BeNil())
 		})
@@ -142,7 +684,7 @@ var _ = Describe("Client", func() {
 				),
 			)
 
-			_, err := client.Stats()
+			_, err := client.Stats(context.Background())
 			Expect(err).To(HaveOccurred())
 		})
 
@@ -152,15 +694,34 @@ var _ = Describe("Client", func() {
 					ghttp.VerifyRequest("GET", "/api/stats"),
 					ghttp.RespondWith(200, `{
 						"count": {
-							"insert": 1
-						}	
+							"insert": 1,
+							"written": 2,
+							"persisted": 3,
+							"dropped": 4
+						},
+						"writer": {"filename": "1.db", "rows": 5},
+						"finalize": {"pending": 6},
+						"upload": {"last_success": "2023-01-01T00:00:00Z", "errors": 7},
+						"buffer": {"capacity": 8, "usage": 9},
+						"uptime": {"seconds": 10.5}
 					}`),
 				),
 			)
 
-			stats, err := client.Stats()
+			stats, err := client.Stats(context.Background())
 			Expect(err).NotTo(HaveOccurred())
 			Expect(stats.Count.Insert).To(BeEquivalentTo(1))
+			Expect(stats.Count.Written).To(BeEquivalentTo(2))
+			Expect(stats.Count.Persisted).To(BeEquivalentTo(3))
+			Expect(stats.Count.Dropped).To(BeEquivalentTo(4))
+			Expect(stats.Writer.Filename).To(Equal("1.db"))
+			Expect(stats.Writer.Rows).To(BeEquivalentTo(5))
+			Expect(stats.Finalize.Pending).To(BeEquivalentTo(6))
+			Expect(stats.Upload.LastSuccess).To(Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+			Expect(stats.Upload.Errors).To(BeEquivalentTo(7))
+			Expect(stats.Buffer.Capacity).To(Equal(8))
+			Expect(stats.Buffer.Usage).To(Equal(9))
+			Expect(stats.Uptime.Seconds).To(Equal(10.5))
 		})
 	})
 })
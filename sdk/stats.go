@@ -1,22 +1,60 @@
 package sdk
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 type StatsPayload struct {
 	Count struct {
+		// Insert is the number of events accepted by the API.
 		Insert uint64 `json:"insert"`
+		// Written is the number of events written to a local database.
+		Written uint64 `json:"written"`
+		// Persisted is the number of events in files uploaded to the bucket.
+		Persisted uint64 `json:"persisted"`
+		// Dropped is the number of events lost to a full buffer.
+		Dropped uint64 `json:"dropped"`
+		// Rejected is the number of events refused because the buffer was full.
+		Rejected uint64 `json:"rejected"`
+		// DroppedLabels is a sample of the label sets dropped, with their counts.
+		DroppedLabels map[string]uint64 `json:"dropped_labels,omitempty"`
 	} `json:"count"`
+	Writer struct {
+		Filename string `json:"filename"`
+		Rows     uint64 `json:"rows"`
+	} `json:"writer"`
+	Finalize struct {
+		Pending int64 `json:"pending"`
+	} `json:"finalize"`
+	Upload struct {
+		LastSuccess time.Time `json:"last_success"`
+		Errors      uint64    `json:"errors"`
+	} `json:"upload"`
+	Buffer struct {
+		Capacity int `json:"capacity"`
+		Usage    int `json:"usage"`
+	} `json:"buffer"`
+	Limits struct {
+		// RateLimited is the number of requests refused for going over a client's rate.
+		RateLimited uint64 `json:"rate_limited"`
+		// TooLarge is the number of requests refused for their body or label sizes.
+		TooLarge uint64 `json:"too_large"`
+	} `json:"limits"`
+	Uptime struct {
+		Seconds float64 `json:"seconds"`
+	} `json:"uptime"`
 }
 
-func (c *Client) Stats() (*StatsPayload, error) {
+func (c *Client) Stats(ctx context.Context) (*StatsPayload, error) {
 	payload := &StatsPayload{}
 
 	client := c.client
 
 	response, err := client.R().
+		SetContext(ctx).
 		SetSuccessResult(payload).
 		Get(fmt.Sprintf("%s/api/stats", c.endpoint))
 	if err != nil {
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Scope is a set of endpoints a principal is allowed to use.
+type Scope string
+
+const (
+	ScopeWrite Scope = "write"
+	ScopeQuery Scope = "query"
+	// ScopeAdmin includes every other scope.
+	ScopeAdmin Scope = "admin"
+)
+
+// Principal is who made a request, and what they are allowed to do.
+type Principal struct {
+	Name   string
+	Scopes []Scope
+}
+
+func (p *Principal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request has none of its credentials,
+	// so the next one is tried.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned when credentials are present but do not match.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Authenticator finds the principal of a request from one kind of credential.
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Principal, error)
+}
+
+const principalKey = "principal"
+
+// anonymous is the principal of every request when no authenticators are configured,
+// which the server only allows with --insecure-no-auth.
+var anonymous = &Principal{Name: "anonymous", Scopes: []Scope{ScopeAdmin}}
+
+// Authenticate is a middleware that sets the request's principal with the first
+// authenticator that recognises its credentials, responding with 401 otherwise.
+// With no authenticators, every request is allowed.
+func Authenticate(authenticators ...Authenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(authenticators) == 0 {
+				c.Set(principalKey, anonymous)
+
+				return next(c)
+			}
+
+			for _, authenticator := range authenticators {
+				principal, err := authenticator.Authenticate(c.Request())
+				if errors.Is(err, ErrNoCredentials) {
+					continue
+				}
+
+				if errors.Is(err, ErrBodyTooLarge) {
+					return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+				}
+
+				if err != nil {
+					return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+				}
+
+				c.Set(principalKey, principal)
+
+				return next(c)
+			}
+
+			return echo.NewHTTPError(http.StatusUnauthorized, ErrNoCredentials.Error())
+		}
+	}
+}
+
+// RequireScope is a middleware that responds with 403 unless the
+// authenticated principal has the scope.
+func RequireScope(scope Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := PrincipalFrom(c)
+			if principal == nil || !principal.Has(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "missing scope "+string(scope))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// PrincipalFrom returns the principal set by Authenticate, nil if there is none.
+func PrincipalFrom(c echo.Context) *Principal {
+	principal, _ := c.Get(principalKey).(*Principal)
+
+	return principal
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const defaultMaxSkew = 5 * time.Minute
+
+// ErrNoCredentialsConfigured is returned for an auth config without any credentials,
+// which would lock everyone out.
+var ErrNoCredentialsConfigured = errors.New("no credentials configured")
+
+// AuthConfig lists the credentials allowed to use the API, and their scopes.
+type AuthConfig struct {
+	Tokens []TokenCredential `json:"tokens"`
+	HMAC   []HMACCredential  `json:"hmac"`
+	MTLS   []MTLSCredential  `json:"mtls"`
+	// MaxBodySize is the largest body read to check an HMAC signature, see HMACKeys.
+	MaxBodySize int64 `json:"-"`
+}
+
+type TokenCredential struct {
+	Name   string  `json:"name"`
+	Token  string  `json:"token"`
+	Scopes []Scope `json:"scopes"`
+}
+
+type HMACCredential struct {
+	Name   string  `json:"name"`
+	KeyID  string  `json:"key_id"`
+	Secret string  `json:"secret"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// MTLSCredential maps the common name of a client certificate to scopes.
+// Client certificates are only verified when the server is using TLS.
+type MTLSCredential struct {
+	Name       string  `json:"name"`
+	CommonName string  `json:"common_name"`
+	Scopes     []Scope `json:"scopes"`
+}
+
+func LoadAuthConfig(filename string) (*AuthConfig, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read auth config: %w", err)
+	}
+
+	config := &AuthConfig{}
+
+	err = json.Unmarshal(contents, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse auth config: %w", err)
+	}
+
+	if len(config.Tokens) == 0 && len(config.HMAC) == 0 && len(config.MTLS) == 0 {
+		return nil, fmt.Errorf("%w in %q", ErrNoCredentialsConfigured, filename)
+	}
+
+	return config, nil
+}
+
+// Authenticators builds an authenticator for each kind of credential configured.
+func (a *AuthConfig) Authenticators() ([]Authenticator, error) {
+	authenticators := []Authenticator{}
+
+	if len(a.Tokens) > 0 {
+		tokens := BearerTokens{}
+
+		for _, token := range a.Tokens {
+			principal, err := newPrincipal(token.Name, token.Scopes)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens[token.Token] = principal
+		}
+
+		authenticators = append(authenticators, tokens)
+	}
+
+	if len(a.HMAC) > 0 {
+		keys := HMACKeys{Keys: map[string]HMACKey{}, MaxSkew: defaultMaxSkew, MaxBodySize: a.MaxBodySize}
+
+		for _, key := range a.HMAC {
+			principal, err := newPrincipal(key.Name, key.Scopes)
+			if err != nil {
+				return nil, err
+			}
+
+			keys.Keys[key.KeyID] = HMACKey{Principal: principal, Secret: []byte(key.Secret)}
+		}
+
+		authenticators = append(authenticators, keys)
+	}
+
+	if len(a.MTLS) > 0 {
+		certificates := ClientCertificates{}
+
+		for _, certificate := range a.MTLS {
+			principal, err := newPrincipal(certificate.Name, certificate.Scopes)
+			if err != nil {
+				return nil, err
+			}
+
+			certificates[certificate.CommonName] = principal
+		}
+
+		authenticators = append(authenticators, certificates)
+	}
+
+	return authenticators, nil
+}
+
+func newPrincipal(name string, scopes []Scope) (*Principal, error) {
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeWrite, ScopeQuery, ScopeAdmin:
+		default:
+			return nil, fmt.Errorf("unknown scope %q for %q", scope, name)
+		}
+	}
+
+	return &Principal{Name: name, Scopes: scopes}, nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+)
+
+// BearerTokens authenticates requests with a static "Authorization: Bearer" token.
+type BearerTokens map[string]*Principal
+
+func (b BearerTokens) Authenticate(req *http.Request) (*Principal, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	for candidate, principal := range b {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			return principal, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// HMACKey is a shared secret used to sign requests.
+type HMACKey struct {
+	Principal *Principal
+	Secret    []byte
+}
+
+// defaultMaxSignedBody is the largest body read to check a signature when HMACKeys has no MaxBodySize.
+const defaultMaxSignedBody = 1 << 20
+
+// HMACKeys authenticates requests signed with sdk.Sign, keyed by key ID.
+// The signed timestamp must be within MaxSkew of the server's clock,
+// which limits how long a captured request can be replayed.
+// Bodies over MaxBodySize, 1MiB by default, are refused with ErrBodyTooLarge
+// rather than read into memory.
+type HMACKeys struct {
+	Keys        map[string]HMACKey
+	MaxSkew     time.Duration
+	MaxBodySize int64
+}
+
+func (h HMACKeys) Authenticate(req *http.Request) (*Principal, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, sdk.HMACScheme+" ") {
+		return nil, ErrNoCredentials
+	}
+
+	params := strings.TrimPrefix(header, sdk.HMACScheme+" ")
+
+	var keyID, signature string
+
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+
+		switch name {
+		case "keyId":
+			keyID = value
+		case "signature":
+			signature = value
+		}
+	}
+
+	key, ok := h.Keys[keyID]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	timestamp := req.Header.Get(sdk.TimestampHeader)
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timestamp", ErrInvalidCredentials)
+	}
+
+	skew := time.Since(time.Unix(seconds, 0))
+	if skew > h.MaxSkew || skew < -h.MaxSkew {
+		return nil, fmt.Errorf("%w: timestamp outside of allowed skew", ErrInvalidCredentials)
+	}
+
+	var body []byte
+
+	if req.Body != nil {
+		maxBodySize := h.MaxBodySize
+		if maxBodySize <= 0 {
+			maxBodySize = defaultMaxSignedBody
+		}
+
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+		if err != nil {
+			return nil, fmt.Errorf("could not read body: %w", err)
+		}
+
+		if int64(len(body)) > maxBodySize {
+			return nil, ErrBodyTooLarge
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := sdk.Sign(key.Secret, req.Method, req.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return key.Principal, nil
+}
+
+// ClientCertificates authenticates requests by the common name of a
+// verified TLS client certificate.
+type ClientCertificates map[string]*Principal
+
+func (c ClientCertificates) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	principal, ok := c[req.TLS.VerifiedChains[0][0].Subject.CommonName]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,209 @@
+package server_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Auth", func() {
+	var router *echo.Echo
+
+	writer := &server.Principal{Name: "writer", Scopes: []server.Scope{server.ScopeWrite}}
+	admin := &server.Principal{Name: "admin", Scopes: []server.Scope{server.ScopeAdmin}}
+
+	ok := func(c echo.Context) error {
+		return c.String(http.StatusOK, server.PrincipalFrom(c).Name)
+	}
+
+	route := func(authenticators ...server.Authenticator) {
+		router = echo.New()
+		router.PUT("/api/events", ok,
+			server.Authenticate(authenticators...),
+			server.RequireScope(server.ScopeWrite),
+		)
+		router.GET("/api/stats", ok,
+			server.Authenticate(authenticators...),
+			server.RequireScope(server.ScopeAdmin),
+		)
+	}
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("allows everything when there are no authenticators", func() {
+		route()
+
+		response := serve(httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal("anonymous"))
+	})
+
+	When("using bearer tokens", func() {
+		BeforeEach(func() {
+			route(server.BearerTokens{"write-token": writer, "admin-token": admin})
+		})
+
+		request := func(method, path, token string) *http.Request {
+			request := httptest.NewRequest(method, path, nil)
+			if token != "" {
+				request.Header.Set("Authorization", "Bearer "+token)
+			}
+
+			return request
+		}
+
+		It("rejects requests without a token", func() {
+			Expect(serve(request(http.MethodPut, "/api/events", "")).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects unknown tokens", func() {
+			Expect(serve(request(http.MethodPut, "/api/events", "nope")).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("enforces scopes", func() {
+			Expect(serve(request(http.MethodPut, "/api/events", "write-token")).Code).To(Equal(http.StatusOK))
+			Expect(serve(request(http.MethodGet, "/api/stats", "write-token")).Code).To(Equal(http.StatusForbidden))
+		})
+
+		It("gives admin every scope", func() {
+			Expect(serve(request(http.MethodPut, "/api/events", "admin-token")).Code).To(Equal(http.StatusOK))
+			Expect(serve(request(http.MethodGet, "/api/stats", "admin-token")).Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	When("using HMAC signatures", func() {
+		secret := []byte("secret")
+
+		BeforeEach(func() {
+			route(server.HMACKeys{
+				Keys:    map[string]server.HMACKey{"key": {Principal: writer, Secret: secret}},
+				MaxSkew: time.Minute,
+			})
+		})
+
+		signed := func(body string, signedAt time.Time, signedBody string) *http.Request {
+			timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+			signature := sdk.Sign(secret, http.MethodPut, "/api/events", timestamp, []byte(signedBody))
+
+			request := httptest.NewRequest(http.MethodPut, "/api/events", strings.NewReader(body))
+			request.Header.Set(sdk.TimestampHeader, timestamp)
+			request.Header.Set("Authorization", fmt.Sprintf("%s keyId=key, signature=%s", sdk.HMACScheme, signature))
+
+			return request
+		}
+
+		It("accepts a valid signature", func() {
+			response := serve(signed(`{"value":"1"}`, time.Now(), `{"value":"1"}`))
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(Equal("writer"))
+		})
+
+		It("rejects a tampered body", func() {
+			Expect(serve(signed(`{"value":"2"}`, time.Now(), `{"value":"1"}`)).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects an old timestamp", func() {
+			Expect(serve(signed(`{}`, time.Now().Add(-time.Hour), `{}`)).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("refuses bodies too large to check", func() {
+			body := strings.Repeat("x", 1<<20+1)
+			Expect(serve(signed(body, time.Now(), body)).Code).To(Equal(http.StatusRequestEntityTooLarge))
+		})
+	})
+
+	When("using client certificates", func() {
+		BeforeEach(func() {
+			route(server.ClientCertificates{"ingest": writer})
+		})
+
+		withCertificate := func(commonName string) *http.Request {
+			request := httptest.NewRequest(http.MethodPut, "/api/events", nil)
+			request.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{
+					{Subject: pkix.Name{CommonName: commonName}},
+				}},
+			}
+
+			return request
+		}
+
+		It("maps the common name to a principal", func() {
+			Expect(serve(withCertificate("ingest")).Code).To(Equal(http.StatusOK))
+		})
+
+		It("rejects unknown common names", func() {
+			Expect(serve(withCertificate("other")).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects requests without a verified certificate", func() {
+			Expect(serve(httptest.NewRequest(http.MethodPut, "/api/events", nil)).Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	It("loads authenticators from a config file", func() {
+		file, err := os.CreateTemp("", "*.json")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString(`{
+			"tokens": [{"name": "ingest", "token": "write-token", "scopes": ["write"]}],
+			"hmac": [{"name": "reporting", "key_id": "key", "secret": "secret", "scopes": ["query"]}]
+		}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		config, err := server.LoadAuthConfig(file.Name())
+		Expect(err).NotTo(HaveOccurred())
+
+		authenticators, err := config.Authenticators()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(authenticators).To(HaveLen(2))
+
+		route(authenticators...)
+
+		request := httptest.NewRequest(http.MethodPut, "/api/events", nil)
+		request.Header.Set("Authorization", "Bearer write-token")
+		Expect(serve(request).Body.String()).To(Equal("ingest"))
+	})
+
+	It("rejects configs without credentials", func() {
+		file, err := os.CreateTemp("", "*.json")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString(`{"tokens": []}`)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = server.LoadAuthConfig(file.Name())
+		Expect(err).To(MatchError(server.ErrNoCredentialsConfigured))
+	})
+
+	It("rejects configs with unknown scopes", func() {
+		config := &server.AuthConfig{
+			Tokens: []server.TokenCredential{{Name: "bad", Token: "token", Scopes: []server.Scope{"root"}}},
+		}
+
+		_, err := config.Authenticators()
+		Expect(err).To(MatchError(ContainSubstring(`unknown scope "root"`)))
+	})
+})
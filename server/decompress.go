@@ -0,0 +1,96 @@
+package server
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+)
+
+// zstdMaxWindow bounds the memory a zstd frame can ask the decoder for.
+const zstdMaxWindow = 8 << 20
+
+// Decompress is a middleware that decodes gzip and zstd request bodies,
+// responding with 415 to other encodings. A decompressed body longer than
+// MaxDecompressedSize fails with ErrBodyTooLarge, so a small compressed
+// body cannot expand without bound.
+func (l *Limiter) Decompress() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			encoding := req.Header.Get(echo.HeaderContentEncoding)
+			if encoding == "" || encoding == "identity" || req.Body == nil {
+				return next(c)
+			}
+
+			if encoding != "gzip" && encoding != "zstd" {
+				return echo.NewHTTPError(http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding %q", encoding))
+			}
+
+			body, err := l.decoder(encoding, req.Body)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			if l.limits.MaxDecompressedSize > 0 {
+				body = &limitedBody{
+					ReadCloser: body,
+					limiter:    l,
+					remaining:  l.limits.MaxDecompressedSize,
+				}
+			}
+
+			req.Body = body
+			req.ContentLength = -1
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+
+			return next(c)
+		}
+	}
+}
+
+func (l *Limiter) decoder(encoding string, body io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read gzip body: %w", err)
+		}
+
+		return &decodedBody{Reader: reader, body: body, close: reader.Close}, nil
+	default:
+		reader, err := zstd.NewReader(body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not read zstd body: %w", err)
+		}
+
+		return &decodedBody{Reader: reader, body: body, close: func() error {
+			reader.Close()
+
+			return nil
+		}}, nil
+	}
+}
+
+// decodedBody closes both the decoder and the original body.
+type decodedBody struct {
+	io.Reader
+	body  io.ReadCloser
+	close func() error
+}
+
+func (d *decodedBody) Close() error {
+	_ = d.close()
+
+	//nolint: wrapcheck
+	return d.body.Close()
+}
@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func gzipped(body string) []byte {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	_, err := writer.Write([]byte(body))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(writer.Close()).To(Succeed())
+
+	return buffer.Bytes()
+}
+
+func zstded(body string) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	defer encoder.Close()
+
+	return encoder.EncodeAll([]byte(body), nil)
+}
+
+var _ = Describe("Decompress", func() {
+	var (
+		router  *echo.Echo
+		limiter *server.Limiter
+	)
+
+	BeforeEach(func() {
+		limiter = server.NewLimiter(server.Limits{MaxDecompressedSize: 100})
+
+		router = echo.New()
+		router.PUT("/api/events", func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if errors.Is(err, server.ErrBodyTooLarge) {
+				return c.NoContent(http.StatusRequestEntityTooLarge)
+			}
+
+			if err != nil {
+				return c.NoContent(http.StatusUnprocessableEntity)
+			}
+
+			return c.String(http.StatusOK, string(body))
+		}, limiter.Decompress())
+	})
+
+	put := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPut, "/api/events", bytes.NewReader(body))
+		request.Header.Set("Content-Encoding", encoding)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("passes through uncompressed bodies", func() {
+		response := put([]byte(`{"value":"plain"}`), "")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal(`{"value":"plain"}`))
+	})
+
+	It("decompresses gzip bodies", func() {
+		response := put(gzipped(`{"value":"gzip"}`), "gzip")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal(`{"value":"gzip"}`))
+	})
+
+	It("decompresses zstd bodies", func() {
+		response := put(zstded(`{"value":"zstd"}`), "zstd")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(Equal(`{"value":"zstd"}`))
+	})
+
+	It("refuses bodies that decompress over the limit", func() {
+		bomb := strings.Repeat("a", 10_000)
+
+		Expect(put(gzipped(bomb), "gzip").Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(put(zstded(bomb), "zstd").Code).To(Equal(http.StatusRequestEntityTooLarge))
+		Expect(limiter.Stats().TooLarge).To(BeEquivalentTo(2))
+	})
+
+	It("refuses unsupported encodings", func() {
+		Expect(put([]byte(`{}`), "br").Code).To(Equal(http.StatusUnsupportedMediaType))
+	})
+
+	It("refuses invalid compressed bodies", func() {
+		Expect(put([]byte(`not gzip`), "gzip").Code).To(Equal(http.StatusBadRequest))
+	})
+})
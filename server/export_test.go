@@ -0,0 +1,10 @@
+package server
+
+import "time"
+
+func (r *CertificateReloader) SetInterval(interval time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.interval = interval
+}
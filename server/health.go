@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/labstack/echo/v4"
+)
+
+// HealthCheck is a named check of a subsystem, returning an error when it is not ready.
+type HealthCheck struct {
+	Name  string
+	Check func() error
+}
+
+// Liveness reports that the process is able to serve requests.
+func Liveness() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		//nolint: wrapcheck
+		return c.JSON(http.StatusOK, sdk.HealthPayload{Status: sdk.HealthOK})
+	}
+}
+
+// Readiness runs every check, responding with 503 when any of them fail.
+func Readiness(checks ...HealthCheck) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		payload := sdk.HealthPayload{
+			Status: sdk.HealthOK,
+			Checks: make(map[string]sdk.HealthCheck, len(checks)),
+		}
+		status := http.StatusOK
+
+		for _, check := range checks {
+			result := sdk.HealthCheck{Status: sdk.HealthOK}
+
+			err := check.Check()
+			if err != nil {
+				result = sdk.HealthCheck{Status: "failed", Error: err.Error()}
+				payload.Status = "failed"
+				status = http.StatusServiceUnavailable
+			}
+
+			payload.Checks[check.Name] = result
+		}
+
+		//nolint: wrapcheck
+		return c.JSON(status, payload)
+	}
+}
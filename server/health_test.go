@@ -0,0 +1,69 @@
+package server_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var router *echo.Echo
+
+	BeforeEach(func() {
+		router = echo.New()
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		return recorder
+	}
+
+	It("reports liveness", func() {
+		router.GET("/healthz", server.Liveness())
+
+		response := get("/healthz")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(MatchJSON(`{"status":"ok"}`))
+	})
+
+	It("is ready when every check passes", func() {
+		router.GET("/readyz", server.Readiness(
+			server.HealthCheck{Name: "first", Check: func() error { return nil }},
+			server.HealthCheck{Name: "second", Check: func() error { return nil }},
+		))
+
+		response := get("/readyz")
+		Expect(response.Code).To(Equal(http.StatusOK))
+		Expect(response.Body.String()).To(MatchJSON(`{
+			"status": "ok",
+			"checks": {
+				"first": {"status": "ok"},
+				"second": {"status": "ok"}
+			}
+		}`))
+	})
+
+	It("is not ready when a check fails", func() {
+		router.GET("/readyz", server.Readiness(
+			server.HealthCheck{Name: "first", Check: func() error { return nil }},
+			server.HealthCheck{Name: "second", Check: func() error { return fmt.Errorf("broken") }},
+		))
+
+		response := get("/readyz")
+		Expect(response.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(response.Body.String()).To(MatchJSON(`{
+			"status": "failed",
+			"checks": {
+				"first": {"status": "ok"},
+				"second": {"status": "failed", "error": "broken"}
+			}
+		}`))
+	})
+})
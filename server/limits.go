@@ -0,0 +1,188 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrBodyTooLarge is returned when reading a request body longer than MaxBodySize.
+	ErrBodyTooLarge = errors.New("request body is too large")
+	// ErrLabelsTooLarge is returned for events with too many, or too long, labels.
+	ErrLabelsTooLarge = errors.New("labels are too large")
+)
+
+// Limits protect the API from a single noisy client. A zero value is unlimited.
+type Limits struct {
+	// Rate is the requests per second allowed for each client, with Burst
+	// requests allowed at once.
+	Rate  float64
+	Burst int
+	// MaxBodySize is the number of bytes allowed in a request body, and
+	// MaxDecompressedSize the bytes allowed once a compressed body is decoded.
+	MaxBodySize         int64
+	MaxDecompressedSize int64
+	// MaxLabels is the number of labels allowed on an event, and MaxLabelSize
+	// the bytes allowed in each label's name and value.
+	MaxLabels    int
+	MaxLabelSize int
+}
+
+type LimitStats struct {
+	RateLimited uint64
+	TooLarge    uint64
+}
+
+// Limiter enforces Limits, counting the requests it refuses.
+type Limiter struct {
+	limits      Limits
+	rateLimited uint64
+	store       *middleware.RateLimiterMemoryStore
+	tooLarge    uint64
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	limiter := &Limiter{limits: limits}
+
+	if limits.Rate > 0 {
+		limiter.store = middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:  rate.Limit(limits.Rate),
+			Burst: limits.Burst,
+		})
+	}
+
+	return limiter
+}
+
+// RateLimit is a middleware that responds with 429 to clients over the rate.
+// Clients are identified by their principal, when authenticated, otherwise by IP.
+func (l *Limiter) RateLimit() echo.MiddlewareFunc {
+	if l.store == nil {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: l.store,
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			principal := PrincipalFrom(c)
+			if principal == nil || principal == anonymous {
+				return "ip:" + c.RealIP(), nil
+			}
+
+			return "principal:" + principal.Name, nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			atomic.AddUint64(&l.rateLimited, 1)
+			httpRateLimited.Inc()
+
+			c.Response().Header().Set("Retry-After", "1")
+
+			return echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+		},
+	})
+}
+
+// BodyLimit is a middleware that responds with 413 to requests declaring a body
+// longer than MaxBodySize. Bodies without a length fail with ErrBodyTooLarge
+// once too much has been read.
+func (l *Limiter) BodyLimit() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if l.limits.MaxBodySize <= 0 {
+				return next(c)
+			}
+
+			req := c.Request()
+			if req.ContentLength > l.limits.MaxBodySize {
+				l.recordTooLarge()
+
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge.Error())
+			}
+
+			if req.Body != nil {
+				req.Body = &limitedBody{
+					ReadCloser: req.Body,
+					limiter:    l,
+					remaining:  l.limits.MaxBodySize,
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// CheckLabels returns ErrLabelsTooLarge when labels are over MaxLabels or MaxLabelSize.
+func (l *Limiter) CheckLabels(labels sdk.Labels) error {
+	if l.limits.MaxLabels > 0 && len(labels) > l.limits.MaxLabels {
+		l.recordTooLarge()
+
+		return fmt.Errorf("%w: %d labels, the maximum is %d", ErrLabelsTooLarge, len(labels), l.limits.MaxLabels)
+	}
+
+	if l.limits.MaxLabelSize > 0 {
+		for name, value := range labels {
+			if len(name)+len(value) > l.limits.MaxLabelSize {
+				l.recordTooLarge()
+
+				return fmt.Errorf("%w: label %q is over %d bytes", ErrLabelsTooLarge, name, l.limits.MaxLabelSize)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *Limiter) Stats() LimitStats {
+	return LimitStats{
+		RateLimited: atomic.LoadUint64(&l.rateLimited),
+		TooLarge:    atomic.LoadUint64(&l.tooLarge),
+	}
+}
+
+func (l *Limiter) recordTooLarge() {
+	atomic.AddUint64(&l.tooLarge, 1)
+	httpTooLarge.Inc()
+}
+
+// limitedBody fails reads past the limit, rather than truncating the body.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded  bool
+	limiter   *Limiter
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+
+	// read one byte past the limit, to tell a body of exactly the limit from a longer one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+
+	if b.remaining < 0 {
+		b.exceeded = true
+		b.limiter.recordTooLarge()
+
+		return n + int(b.remaining), ErrBodyTooLarge
+	}
+
+	//nolint: wrapcheck
+	return n, err
+}
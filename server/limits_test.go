@@ -0,0 +1,136 @@
+package server_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/server"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limits", func() {
+	var (
+		router  *echo.Echo
+		limiter *server.Limiter
+	)
+
+	route := func(limits server.Limits, authenticators ...server.Authenticator) {
+		limiter = server.NewLimiter(limits)
+
+		router = echo.New()
+		router.PUT("/api/events", func(c echo.Context) error {
+			body, err := io.ReadAll(c.Request().Body)
+			if errors.Is(err, server.ErrBodyTooLarge) {
+				return c.NoContent(http.StatusRequestEntityTooLarge)
+			}
+
+			return c.String(http.StatusOK, string(body))
+		}, limiter.BodyLimit(), server.Authenticate(authenticators...), limiter.RateLimit())
+	}
+
+	put := func(body string, headers ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPut, "/api/events", strings.NewReader(body))
+		for i := 0; i < len(headers); i += 2 {
+			request.Header.Set(headers[i], headers[i+1])
+		}
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		return recorder
+	}
+
+	It("allows everything by default", func() {
+		route(server.Limits{})
+
+		for i := 0; i < 100; i++ {
+			Expect(put(strings.Repeat("a", 1000)).Code).To(Equal(http.StatusOK))
+		}
+
+		Expect(limiter.CheckLabels(sdk.Labels{"name": strings.Repeat("a", 1000)})).To(Succeed())
+		Expect(limiter.Stats()).To(Equal(server.LimitStats{}))
+	})
+
+	When("rate limiting", func() {
+		It("limits each IP", func() {
+			route(server.Limits{Rate: 1, Burst: 2})
+
+			Expect(put("", "X-Real-IP", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			Expect(put("", "X-Real-IP", "10.0.0.1").Code).To(Equal(http.StatusOK))
+
+			response := put("", "X-Real-IP", "10.0.0.1")
+			Expect(response.Code).To(Equal(http.StatusTooManyRequests))
+			Expect(response.Header().Get("Retry-After")).To(Equal("1"))
+
+			Expect(put("", "X-Real-IP", "10.0.0.2").Code).To(Equal(http.StatusOK))
+
+			Expect(limiter.Stats().RateLimited).To(BeEquivalentTo(1))
+		})
+
+		It("limits each principal, wherever they connect from", func() {
+			route(server.Limits{Rate: 1, Burst: 1}, server.BearerTokens{
+				"first":  {Name: "first"},
+				"second": {Name: "second"},
+			})
+
+			Expect(put("", "Authorization", "Bearer first", "X-Real-IP", "10.0.0.1").Code).To(Equal(http.StatusOK))
+			Expect(put("", "Authorization", "Bearer first", "X-Real-IP", "10.0.0.2").Code).To(Equal(http.StatusTooManyRequests))
+			Expect(put("", "Authorization", "Bearer second", "X-Real-IP", "10.0.0.1").Code).To(Equal(http.StatusOK))
+		})
+	})
+
+	When("limiting the body size", func() {
+		BeforeEach(func() {
+			route(server.Limits{MaxBodySize: 10})
+		})
+
+		It("allows bodies up to the limit", func() {
+			response := put(strings.Repeat("a", 10))
+			Expect(response.Code).To(Equal(http.StatusOK))
+			Expect(response.Body.String()).To(HaveLen(10))
+		})
+
+		It("refuses bodies declared over the limit", func() {
+			Expect(put(strings.Repeat("a", 11)).Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(limiter.Stats().TooLarge).To(BeEquivalentTo(1))
+		})
+
+		It("refuses bodies read over the limit", func() {
+			request := httptest.NewRequest(http.MethodPut, "/api/events", strings.NewReader(strings.Repeat("a", 11)))
+			request.ContentLength = -1
+
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			Expect(recorder.Code).To(Equal(http.StatusRequestEntityTooLarge))
+			Expect(limiter.Stats().TooLarge).To(BeEquivalentTo(1))
+		})
+	})
+
+	When("limiting labels", func() {
+		BeforeEach(func() {
+			route(server.Limits{MaxLabels: 2, MaxLabelSize: 10})
+		})
+
+		It("allows labels within the limits", func() {
+			Expect(limiter.CheckLabels(sdk.Labels{"a": "1", "b": "123456789"})).To(Succeed())
+		})
+
+		It("refuses too many labels", func() {
+			err := limiter.CheckLabels(sdk.Labels{"a": "1", "b": "2", "c": "3"})
+			Expect(err).To(MatchError(server.ErrLabelsTooLarge))
+		})
+
+		It("refuses long labels", func() {
+			err := limiter.CheckLabels(sdk.Labels{"name": "1234567"})
+			Expect(err).To(MatchError(server.ErrLabelsTooLarge))
+			Expect(limiter.Stats().TooLarge).To(BeEquivalentTo(1))
+		})
+	})
+})
@@ -11,6 +11,7 @@ import (
 )
 
 // ZapLogger is a middleware and zap to provide an "access log" like logging for each request.
+// It also records the request in the HTTP metrics, labeled by route rather than URI.
 func ZapLogger(log *zap.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -40,6 +41,9 @@ func ZapLogger(log *zap.Logger) echo.MiddlewareFunc {
 
 			latency := stop.Sub(start)
 
+			httpRequests.WithLabelValues(c.Path(), req.Method, strconv.Itoa(res.Status)).Inc()
+			httpRequestDuration.WithLabelValues(c.Path(), req.Method).Observe(latency.Seconds())
+
 			const preferredBase = 10
 			fields := []zapcore.Field{
 				zap.String("bytes_in", contentLength),
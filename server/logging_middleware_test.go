@@ -10,6 +10,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/ghttp"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -17,6 +18,7 @@ import (
 var _ = Describe("LoggingMiddleware", func() {
 	var (
 		buffer     *gbytes.Buffer
+		router     *echo.Echo
 		serverHTTP *ghttp.Server
 	)
 
@@ -30,7 +32,7 @@ var _ = Describe("LoggingMiddleware", func() {
 			),
 		)
 
-		router := echo.New()
+		router = echo.New()
 		router.Use(server.ZapLogger(logger))
 		router.GET("/", func(c echo.Context) error {
 			//nolint: wrapcheck
@@ -43,6 +45,7 @@ var _ = Describe("LoggingMiddleware", func() {
 		router.GET("/error", func(c echo.Context) error {
 			return fmt.Errorf("some error message")
 		})
+		router.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 
 		serverHTTP = ghttp.NewServer()
 		serverHTTP.AppendHandlers(router.ServeHTTP)
@@ -91,6 +94,22 @@ var _ = Describe("LoggingMiddleware", func() {
 		})
 	})
 
+	When("metrics are requested", func() {
+		It("includes the request by route", func() {
+			_, err := req.C().R().
+				Get(fmt.Sprintf("%s/empty", serverHTTP.URL()))
+			Expect(err).NotTo(HaveOccurred())
+
+			serverHTTP.AppendHandlers(router.ServeHTTP)
+
+			response, err := req.C().R().
+				Get(fmt.Sprintf("%s/metrics", serverHTTP.URL()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.String()).To(ContainSubstring(`tsdb_http_requests_total{method="GET",path="/empty",status="200"}`))
+			Expect(response.String()).To(ContainSubstring(`tsdb_http_request_duration_seconds_count{method="GET",path="/empty"}`))
+		})
+	})
+
 	When("a request ID is provided", func() {
 		It("uses that one", func() {
 			_, err := req.C().R().
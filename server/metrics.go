@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tsdb",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests, by route, method and status.",
+	}, []string{"path", "method", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tsdb",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time to serve an HTTP request, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"path", "method"})
+	httpRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tsdb",
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Requests refused for going over a client's rate limit.",
+	})
+	httpTooLarge = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "tsdb",
+		Subsystem: "http",
+		Name:      "too_large_total",
+		Help:      "Requests refused for a body or labels over the size limits.",
+	})
+)
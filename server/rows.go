@@ -0,0 +1,224 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEApplicationJSON   = "application/json"
+	MIMEApplicationNDJSON = "application/x-ndjson"
+	MIMETextCSV           = "text/csv"
+	MIMEArrowStream       = "application/vnd.apache.arrow.stream"
+
+	// QueryErrorTrailer is the trailer set when a query fails after rows have been sent.
+	QueryErrorTrailer = "X-Query-Error"
+)
+
+var rowFormats = []string{MIMEApplicationJSON, MIMEApplicationNDJSON, MIMETextCSV, MIMEArrowStream}
+
+// NegotiateFormat picks the most preferred media type in an Accept header
+// that rows can be written as, defaulting to JSON.
+func NegotiateFormat(accept string) string {
+	type preference struct {
+		mediaType string
+		quality   float64
+	}
+
+	preferences := []preference{}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		preferences = append(preferences, preference{mediaType: mediaType, quality: quality})
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, preference := range preferences {
+		if preference.quality <= 0 {
+			continue
+		}
+
+		for _, format := range rowFormats {
+			if preference.mediaType == format {
+				return format
+			}
+		}
+	}
+
+	return MIMEApplicationJSON
+}
+
+// RowWriter encodes query rows as they are produced. Nothing is written
+// until the first row, or Close, so errors before then can still be reported
+// with a status code.
+type RowWriter interface {
+	// WriteRow with nil values only gives the columns of a result without rows.
+	WriteRow(columns []string, values []any) error
+	// Close finishes the output, which is still valid when there were no rows.
+	Close() error
+}
+
+// NewRowWriter returns a writer for a media type from NegotiateFormat.
+func NewRowWriter(mediaType string, w io.Writer) RowWriter {
+	switch mediaType {
+	case MIMEApplicationNDJSON:
+		return &ndjsonRows{encoder: json.NewEncoder(w)}
+	case MIMETextCSV:
+		return &csvRows{writer: csv.NewWriter(w)}
+	case MIMEArrowStream:
+		return &arrowRows{writer: w}
+	default:
+		return &jsonRows{writer: w}
+	}
+}
+
+func rowObject(columns []string, values []any) map[string]any {
+	row := make(map[string]any, len(columns))
+	for index, column := range columns {
+		row[column] = values[index]
+	}
+
+	return row
+}
+
+// jsonRows writes an array of objects.
+type jsonRows struct {
+	started bool
+	writer  io.Writer
+}
+
+func (j *jsonRows) WriteRow(columns []string, values []any) error {
+	if values == nil {
+		return nil
+	}
+
+	contents, err := json.Marshal(rowObject(columns, values))
+	if err != nil {
+		return fmt.Errorf("could not encode row: %w", err)
+	}
+
+	separator := ","
+	if !j.started {
+		separator = "["
+		j.started = true
+	}
+
+	_, err = fmt.Fprintf(j.writer, "%s%s", separator, contents)
+	if err != nil {
+		return fmt.Errorf("could not write row: %w", err)
+	}
+
+	return nil
+}
+
+func (j *jsonRows) Close() error {
+	end := "]\n"
+	if !j.started {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(j.writer, end)
+	if err != nil {
+		return fmt.Errorf("could not write rows: %w", err)
+	}
+
+	return nil
+}
+
+// ndjsonRows writes an object per line.
+type ndjsonRows struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonRows) WriteRow(columns []string, values []any) error {
+	if values == nil {
+		return nil
+	}
+
+	err := n.encoder.Encode(rowObject(columns, values))
+	if err != nil {
+		return fmt.Errorf("could not write row: %w", err)
+	}
+
+	return nil
+}
+
+func (n *ndjsonRows) Close() error {
+	return nil
+}
+
+// csvRows writes a header of the column names, then a record per row.
+type csvRows struct {
+	started bool
+	writer  *csv.Writer
+}
+
+func (c *csvRows) WriteRow(columns []string, values []any) error {
+	if !c.started {
+		c.started = true
+
+		err := c.writer.Write(columns)
+		if err != nil {
+			return fmt.Errorf("could not write header: %w", err)
+		}
+	}
+
+	if values == nil {
+		return nil
+	}
+
+	record := make([]string, len(values))
+	for index, value := range values {
+		record[index] = formatValue(value)
+	}
+
+	err := c.writer.Write(record)
+	if err != nil {
+		return fmt.Errorf("could not write row: %w", err)
+	}
+
+	return nil
+}
+
+func (c *csvRows) Close() error {
+	c.writer.Flush()
+
+	//nolint: wrapcheck
+	return c.writer.Error()
+}
+
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
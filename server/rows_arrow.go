@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+const arrowBatchSize = 1024
+
+// ErrArrowSchema is a value that does not fit the type inferred for its column.
+var ErrArrowSchema = errors.New("value does not fit the arrow schema")
+
+// arrowRows writes an Arrow IPC stream, a record batch per arrowBatchSize rows.
+// The schema is inferred from the first batch: a column is int64 when all of
+// its values are integers, float64 when they are numbers, and a string
+// otherwise. As the schema of a stream cannot change, a later value that does
+// not fit its numeric column stops the stream with ErrArrowSchema.
+type arrowRows struct {
+	allocator memory.Allocator
+	batch     [][]any
+	columns   []string
+	ipc       *ipc.Writer
+	schema    *arrow.Schema
+	writer    io.Writer
+}
+
+func (a *arrowRows) WriteRow(columns []string, values []any) error {
+	a.columns = columns
+
+	if values == nil {
+		return nil
+	}
+
+	a.batch = append(a.batch, values)
+
+	if len(a.batch) < arrowBatchSize {
+		return nil
+	}
+
+	return a.flush()
+}
+
+func (a *arrowRows) Close() error {
+	if len(a.batch) > 0 {
+		err := a.flush()
+		if err != nil {
+			return err
+		}
+	}
+
+	// without rows the stream is only the schema
+	a.start()
+
+	err := a.ipc.Close()
+	if err != nil {
+		return fmt.Errorf("could not close arrow stream: %w", err)
+	}
+
+	return nil
+}
+
+func (a *arrowRows) start() {
+	if a.ipc == nil {
+		a.allocator = memory.NewGoAllocator()
+		a.schema = inferSchema(a.columns, a.batch)
+		a.ipc = ipc.NewWriter(a.writer, ipc.WithSchema(a.schema), ipc.WithAllocator(a.allocator))
+	}
+}
+
+func (a *arrowRows) flush() error {
+	a.start()
+
+	builder := array.NewRecordBuilder(a.allocator, a.schema)
+	defer builder.Release()
+
+	for _, values := range a.batch {
+		for index, value := range values {
+			if !appendValue(builder.Field(index), value) {
+				return fmt.Errorf("%w: column %s is %s, inferred from the first %d rows, but has %v",
+					ErrArrowSchema, a.columns[index], a.schema.Field(index).Type, arrowBatchSize, value)
+			}
+		}
+	}
+
+	record := builder.NewRecord()
+	defer record.Release()
+
+	a.batch = a.batch[:0]
+
+	err := a.ipc.Write(record)
+	if err != nil {
+		return fmt.Errorf("could not write arrow record: %w", err)
+	}
+
+	return nil
+}
+
+func inferSchema(columns []string, rows [][]any) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+
+	for index, column := range columns {
+		integers, numbers, others := 0, 0, 0
+
+		for _, row := range rows {
+			switch row[index].(type) {
+			case nil:
+			case int64:
+				integers++
+			case float64:
+				numbers++
+			default:
+				others++
+			}
+		}
+
+		var dataType arrow.DataType = arrow.BinaryTypes.String
+
+		switch {
+		case others > 0 || integers+numbers == 0:
+		case numbers > 0:
+			dataType = arrow.PrimitiveTypes.Float64
+		default:
+			dataType = arrow.PrimitiveTypes.Int64
+		}
+
+		fields[index] = arrow.Field{Name: column, Type: dataType, Nullable: true}
+	}
+
+	return arrow.NewSchema(fields, nil)
+}
+
+// appendValue is false when the value does not fit the builder's type.
+func appendValue(builder array.Builder, value any) bool {
+	switch builder := builder.(type) {
+	case *array.Int64Builder:
+		switch value := value.(type) {
+		case nil:
+			builder.AppendNull()
+		case int64:
+			builder.Append(value)
+		case float64:
+			if value != float64(int64(value)) {
+				return false
+			}
+
+			builder.Append(int64(value))
+		default:
+			return false
+		}
+	case *array.Float64Builder:
+		switch value := value.(type) {
+		case nil:
+			builder.AppendNull()
+		case int64:
+			builder.Append(float64(value))
+		case float64:
+			builder.Append(value)
+		default:
+			return false
+		}
+	case *array.StringBuilder:
+		if value == nil {
+			builder.AppendNull()
+		} else {
+			builder.Append(formatValue(value))
+		}
+	}
+
+	return true
+}
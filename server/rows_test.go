@@ -0,0 +1,143 @@
+package server_test
+
+import (
+	"bytes"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/jtarchie/sqlite-tsdb/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Rows", func() {
+	columns := []string{"id", "value", "score"}
+	rows := [][]any{
+		{int64(1), "first", 1.5},
+		{int64(2), nil, int64(2)},
+	}
+
+	write := func(mediaType string, rows [][]any) string {
+		buffer := &bytes.Buffer{}
+
+		writer := server.NewRowWriter(mediaType, buffer)
+		for _, row := range rows {
+			Expect(writer.WriteRow(columns, row)).To(Succeed())
+		}
+
+		// as a query without rows still gives its columns
+		if len(rows) == 0 {
+			Expect(writer.WriteRow(columns, nil)).To(Succeed())
+		}
+
+		Expect(writer.Close()).To(Succeed())
+
+		return buffer.String()
+	}
+
+	DescribeTable("negotiating the format",
+		func(accept string, expected string) {
+			Expect(server.NegotiateFormat(accept)).To(Equal(expected))
+		},
+		Entry("defaults to JSON", "", server.MIMEApplicationJSON),
+		Entry("ignores unknown types", "text/html", server.MIMEApplicationJSON),
+		Entry("accepts NDJSON", "application/x-ndjson", server.MIMEApplicationNDJSON),
+		Entry("accepts CSV with parameters", "text/csv; charset=utf-8", server.MIMETextCSV),
+		Entry("accepts Arrow", "application/vnd.apache.arrow.stream", server.MIMEArrowStream),
+		Entry("prefers higher quality", "text/csv;q=0.5, application/x-ndjson", server.MIMEApplicationNDJSON),
+		Entry("skips refused types", "text/csv;q=0, text/html", server.MIMEApplicationJSON),
+	)
+
+	It("writes JSON as an array of objects", func() {
+		Expect(write(server.MIMEApplicationJSON, rows)).To(MatchJSON(`[
+			{"id": 1, "value": "first", "score": 1.5},
+			{"id": 2, "value": null, "score": 2}
+		]`))
+		Expect(write(server.MIMEApplicationJSON, nil)).To(MatchJSON(`[]`))
+	})
+
+	It("writes NDJSON as an object per line", func() {
+		Expect(write(server.MIMEApplicationNDJSON, rows)).To(Equal(
+			`{"id":1,"score":1.5,"value":"first"}` + "\n" +
+				`{"id":2,"score":2,"value":null}` + "\n",
+		))
+		Expect(write(server.MIMEApplicationNDJSON, nil)).To(BeEmpty())
+	})
+
+	It("writes CSV with a header", func() {
+		Expect(write(server.MIMETextCSV, rows)).To(Equal("id,value,score\n1,first,1.5\n2,,2\n"))
+		Expect(write(server.MIMETextCSV, nil)).To(Equal("id,value,score\n"))
+	})
+
+	It("writes an Arrow stream with inferred types", func() {
+		reader, err := ipc.NewReader(bytes.NewBufferString(write(server.MIMEArrowStream, rows)))
+		Expect(err).NotTo(HaveOccurred())
+
+		defer reader.Release()
+
+		schema := reader.Schema()
+		Expect(schema.Field(0).Type).To(Equal(arrow.PrimitiveTypes.Int64))
+		Expect(schema.Field(1).Type).To(Equal(arrow.BinaryTypes.String))
+		Expect(schema.Field(2).Type).To(Equal(arrow.PrimitiveTypes.Float64))
+
+		Expect(reader.Next()).To(BeTrue())
+
+		record := reader.Record()
+		Expect(record.NumRows()).To(BeEquivalentTo(2))
+		Expect(record.Column(0).(*array.Int64).Int64Values()).To(Equal([]int64{1, 2}))
+		Expect(record.Column(1).(*array.String).Value(0)).To(Equal("first"))
+		Expect(record.Column(1).IsNull(1)).To(BeTrue())
+		Expect(record.Column(2).(*array.Float64).Float64Values()).To(Equal([]float64{1.5, 2}))
+
+		Expect(reader.Next()).To(BeFalse())
+	})
+
+	It("writes Arrow record batches as rows are produced", func() {
+		many := make([][]any, 2000)
+		for index := range many {
+			many[index] = []any{int64(index), "value", 1.0}
+		}
+
+		reader, err := ipc.NewReader(bytes.NewBufferString(write(server.MIMEArrowStream, many)))
+		Expect(err).NotTo(HaveOccurred())
+
+		defer reader.Release()
+
+		batches := []int64{}
+		for reader.Next() {
+			batches = append(batches, reader.Record().NumRows())
+		}
+
+		Expect(batches).To(Equal([]int64{1024, 976}))
+	})
+
+	It("writes an Arrow schema without rows", func() {
+		reader, err := ipc.NewReader(bytes.NewBufferString(write(server.MIMEArrowStream, nil)))
+		Expect(err).NotTo(HaveOccurred())
+
+		defer reader.Release()
+
+		Expect(reader.Schema().Fields()).To(HaveLen(3))
+		Expect(reader.Schema().Field(0).Name).To(Equal("id"))
+		Expect(reader.Next()).To(BeFalse())
+	})
+
+	It("refuses values that do not fit the inferred Arrow schema", func() {
+		writer := server.NewRowWriter(server.MIMEArrowStream, &bytes.Buffer{})
+
+		var err error
+		for index := 0; index <= 1024 && err == nil; index++ {
+			err = writer.WriteRow(columns, []any{int64(index), "value", 1.0})
+		}
+
+		Expect(err).NotTo(HaveOccurred())
+
+		for index := 0; index < 1024 && err == nil; index++ {
+			err = writer.WriteRow(columns, []any{int64(index), "value", "not a number"})
+		}
+
+		Expect(err).To(MatchError(server.ErrArrowSchema))
+		Expect(err).To(MatchError(ContainSubstring("column score is float64")))
+	})
+})
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const certificateCheckInterval = 10 * time.Second
+
+// CertificateReloader serves a certificate from files, reloading it when
+// either file changes, so certificates can be rotated without a restart.
+type CertificateReloader struct {
+	cert       *tls.Certificate
+	certFile   string
+	checkedAt  time.Time
+	interval   time.Duration
+	keyFile    string
+	logger     *zap.Logger
+	modifiedAt time.Time
+	mutex      sync.Mutex
+}
+
+func NewCertificateReloader(certFile, keyFile string, logger *zap.Logger) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{
+		certFile: certFile,
+		interval: certificateCheckInterval,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+
+	modifiedAt, err := reloader.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	err = reloader.load(modifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// GetCertificate is for tls.Config, checking for changed files at most every few seconds.
+// A certificate that fails to load is logged, and the previous one kept.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) < r.interval {
+		return r.cert, nil
+	}
+
+	r.checkedAt = time.Now()
+
+	modifiedAt, err := r.lastModified()
+	if err != nil {
+		r.logger.Error("could not check certificate", zap.Error(err))
+
+		return r.cert, nil
+	}
+
+	if !modifiedAt.Equal(r.modifiedAt) {
+		err = r.load(modifiedAt)
+		if err != nil {
+			r.logger.Error("could not reload certificate", zap.Error(err))
+		} else {
+			r.logger.Info("reloaded certificate", zap.String("cert", r.certFile))
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) load(modifiedAt time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("could not load certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.modifiedAt = modifiedAt
+
+	return nil
+}
+
+// lastModified is the latest modification time of the certificate and key.
+func (r *CertificateReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+
+	for _, filename := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("could not stat %q: %w", filename, err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// TLSConfig serves the reloader's certificate, offering HTTP/2. When clientCAFile is set,
+// client certificates signed by it are verified, and required if requireClientCert.
+func TLSConfig(reloader *CertificateReloader, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	contents, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read client CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %q", clientCAFile)
+	}
+
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
@@ -0,0 +1,243 @@
+package server_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+// certificate is a generated key pair, signed by parent or self-signed.
+type certificate struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newCertificate(commonName string, parent *certificate) *certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return &certificate{cert: cert, der: der, key: key}
+}
+
+func (c *certificate) write(certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func (c *certificate) keyPair() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+var _ = Describe("TLS", func() {
+	var (
+		dir      string
+		certFile string
+		keyFile  string
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile = filepath.Join(dir, "key.pem")
+	})
+
+	// serve completes TLS handshakes, responding to each client that succeeds.
+	serve := func(config *tls.Config) string {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+
+				if conn.(*tls.Conn).Handshake() == nil {
+					_, _ = conn.Write([]byte("ok"))
+				}
+
+				conn.Close()
+			}
+		}()
+
+		return listener.Addr().String()
+	}
+
+	// handshake returns the certificate the server presented.
+	handshake := func(address string, clientCerts ...tls.Certificate) (*x509.Certificate, error) {
+		conn, err := tls.Dial("tcp", address, &tls.Config{
+			//nolint: gosec
+			InsecureSkipVerify: true,
+			// always send the certificate, even when the server does not list its CA
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(clientCerts) == 0 {
+					return &tls.Certificate{}, nil
+				}
+
+				return &clientCerts[0], nil
+			},
+			NextProtos: []string{"h2"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		// with TLS 1.3, a rejected client certificate is only seen on the first read
+		_, err = conn.Read(make([]byte, 1))
+		if err != nil {
+			return nil, err
+		}
+
+		Expect(conn.ConnectionState().NegotiatedProtocol).To(Equal("h2"))
+
+		return conn.ConnectionState().PeerCertificates[0], nil
+	}
+
+	It("reloads the certificate when the files change", func() {
+		first := newCertificate("first", nil)
+		first.write(certFile, keyFile)
+
+		reloader, err := server.NewCertificateReloader(certFile, keyFile, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		reloader.SetInterval(0)
+
+		config, err := server.TLSConfig(reloader, "", false)
+		Expect(err).NotTo(HaveOccurred())
+
+		address := serve(config)
+
+		cert, err := handshake(address)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.Subject.CommonName).To(Equal("first"))
+
+		second := newCertificate("second", nil)
+		second.write(certFile, keyFile)
+
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(certFile, later, later)).To(Succeed())
+
+		cert, err = handshake(address)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cert.Subject.CommonName).To(Equal("second"))
+	})
+
+	It("keeps the previous certificate when the new one is invalid", func() {
+		newCertificate("first", nil).write(certFile, keyFile)
+
+		reloader, err := server.NewCertificateReloader(certFile, keyFile, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		reloader.SetInterval(0)
+
+		Expect(os.WriteFile(keyFile, []byte("not a key"), 0o600)).To(Succeed())
+
+		later := time.Now().Add(time.Minute)
+		Expect(os.Chtimes(keyFile, later, later)).To(Succeed())
+
+		cert, err := reloader.GetCertificate(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leaf.Subject.CommonName).To(Equal("first"))
+	})
+
+	It("errors when the certificate cannot be loaded", func() {
+		_, err := server.NewCertificateReloader(certFile, keyFile, zap.NewNop())
+		Expect(err).To(HaveOccurred())
+	})
+
+	When("verifying client certificates", func() {
+		var (
+			ca     *certificate
+			caFile string
+		)
+
+		BeforeEach(func() {
+			newCertificate("server", nil).write(certFile, keyFile)
+
+			ca = newCertificate("ca", nil)
+			caFile = filepath.Join(dir, "ca.pem")
+			ca.write(caFile, filepath.Join(dir, "ca-key.pem"))
+		})
+
+		start := func(require bool) string {
+			reloader, err := server.NewCertificateReloader(certFile, keyFile, zap.NewNop())
+			Expect(err).NotTo(HaveOccurred())
+
+			config, err := server.TLSConfig(reloader, caFile, require)
+			Expect(err).NotTo(HaveOccurred())
+
+			return serve(config)
+		}
+
+		It("accepts clients signed by the CA", func() {
+			address := start(true)
+
+			_, err := handshake(address, newCertificate("client", ca).keyPair())
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("rejects clients signed by another CA", func() {
+			address := start(false)
+
+			other := newCertificate("other", nil)
+			_, err := handshake(address, newCertificate("client", other).keyPair())
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("allows clients without a certificate unless required", func() {
+			_, err := handshake(start(false))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = handshake(start(true))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
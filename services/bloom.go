@@ -0,0 +1,88 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+const bloomFalsePositiveRate = 0.01
+
+// bloomFilter answers whether a value may have been added, with no false negatives.
+type bloomFilter struct {
+	bits   []byte
+	hashes uint8
+}
+
+// newBloomFilter sizes a filter for count values at bloomFalsePositiveRate.
+func newBloomFilter(count int) *bloomFilter {
+	if count < 1 {
+		count = 1
+	}
+
+	bits := math.Ceil(-float64(count) * math.Log(bloomFalsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(bits/float64(count)*math.Ln2))
+
+	return &bloomFilter{
+		bits:   make([]byte, int(math.Ceil(bits/8))),
+		hashes: uint8(hashes),
+	}
+}
+
+// locations uses double hashing to derive each hash from one 64 bit hash.
+func (b *bloomFilter) locations(value string) []uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(value))
+	sum := hash.Sum64()
+
+	lower, upper := sum&math.MaxUint32, sum>>32
+	size := uint64(len(b.bits)) * 8
+
+	locations := make([]uint64, b.hashes)
+	for index := range locations {
+		locations[index] = (lower + uint64(index)*upper) % size
+	}
+
+	return locations
+}
+
+func (b *bloomFilter) add(value string) {
+	for _, location := range b.locations(value) {
+		b.bits[location/8] |= 1 << (location % 8)
+	}
+}
+
+func (b *bloomFilter) has(value string) bool {
+	for _, location := range b.locations(value) {
+		if b.bits[location/8]&(1<<(location%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encode is the number of hashes followed by the bits, in base64.
+func (b *bloomFilter) encode() string {
+	return base64.StdEncoding.EncodeToString(append([]byte{b.hashes}, b.bits...))
+}
+
+func decodeBloomFilter(encoded string) (*bloomFilter, error) {
+	contents, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode bloom filter: %w", err)
+	}
+
+	if len(contents) < 2 || contents[0] == 0 {
+		return nil, errors.New("bloom filter is empty")
+	}
+
+	return &bloomFilter{bits: contents[1:], hashes: contents[0]}, nil
+}
+
+// labelPair is how a label is added to a file's bloom filter.
+func labelPair(key, value string) string {
+	return key + "\x00" + value
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Buffer is a fixed size queue that drops the oldest value when it is full,
+// so a slow reader never blocks writers.
+// It replaces ringbuffer.Channel, which drops values without counting them,
+// so the drops can be reported by the metrics and stats.
+type Buffer[T any] struct {
+	dropped uint64
+	input   chan T
+	onDrop  func(T)
+	output  chan T
+}
+
+// NewBuffer creates a buffer holding up to size values.
+// onDrop, when not nil, is called with each value dropped to make room.
+func NewBuffer[T any](size int, onDrop func(T)) *Buffer[T] {
+	b := &Buffer[T]{
+		input:  make(chan T),
+		onDrop: onDrop,
+		output: make(chan T, size),
+	}
+	go b.run()
+
+	return b
+}
+
+func (b *Buffer[T]) run() {
+	for value := range b.input {
+	retry:
+		select {
+		case b.output <- value:
+		default:
+			select {
+			case dropped := <-b.output:
+				atomic.AddUint64(&b.dropped, 1)
+
+				if b.onDrop != nil {
+					b.onDrop(dropped)
+				}
+			default:
+			}
+
+			goto retry
+		}
+	}
+
+	close(b.output)
+}
+
+// Write adds a value, dropping the oldest one if the buffer is full.
+func (b *Buffer[T]) Write(value T) {
+	b.input <- value
+}
+
+// TryWrite adds a value only if there is room, never dropping another.
+func (b *Buffer[T]) TryWrite(value T) bool {
+	select {
+	case b.output <- value:
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteTimeout waits up to timeout for room to add a value, never dropping another.
+func (b *Buffer[T]) WriteTimeout(value T, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case b.output <- value:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Read waits for the next value. It returns false once the buffer is closed and drained.
+func (b *Buffer[T]) Read() (T, bool) {
+	value, ok := <-b.output
+
+	return value, ok
+}
+
+func (b *Buffer[T]) Close() {
+	close(b.input)
+}
+
+// Len is the number of values waiting to be read.
+func (b *Buffer[T]) Len() int {
+	return len(b.output)
+}
+
+// Cap is the number of values the buffer holds before dropping.
+func (b *Buffer[T]) Cap() int {
+	return cap(b.output)
+}
+
+// Dropped is the number of values dropped since the buffer was created.
+func (b *Buffer[T]) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
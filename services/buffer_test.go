@@ -0,0 +1,66 @@
+package services_test
+
+import (
+	"sync/atomic"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Buffer", func() {
+	It("reads values in the order written", func() {
+		buffer := services.NewBuffer[int](5, nil)
+		defer buffer.Close()
+
+		for i := 1; i <= 5; i++ {
+			buffer.Write(i)
+		}
+
+		Eventually(buffer.Len).Should(Equal(5))
+		Expect(buffer.Cap()).To(Equal(5))
+
+		for i := 1; i <= 5; i++ {
+			value, ok := buffer.Read()
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(i))
+		}
+
+		Expect(buffer.Dropped()).To(BeEquivalentTo(0))
+	})
+
+	It("drops the oldest values when full", func() {
+		var dropped int64
+
+		buffer := services.NewBuffer(5, func(int) {
+			atomic.AddInt64(&dropped, 1)
+		})
+		defer buffer.Close()
+
+		for i := 1; i <= 100; i++ {
+			buffer.Write(i)
+		}
+
+		Eventually(buffer.Dropped).Should(BeEquivalentTo(95))
+		Expect(atomic.LoadInt64(&dropped)).To(BeEquivalentTo(95))
+
+		for i := 96; i <= 100; i++ {
+			value, ok := buffer.Read()
+			Expect(ok).To(BeTrue())
+			Expect(value).To(Equal(i))
+		}
+	})
+
+	It("stops reading once closed and drained", func() {
+		buffer := services.NewBuffer[int](5, nil)
+		buffer.Write(1)
+		buffer.Close()
+
+		value, ok := buffer.Read()
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(1))
+
+		_, ok = buffer.Read()
+		Expect(ok).To(BeFalse())
+	})
+})
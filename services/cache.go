@@ -0,0 +1,224 @@
+package services
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const cacheDownloadSuffix = ".download"
+
+// FileCache keeps downloaded database files on disk, up to a size, evicting
+// the least recently used. Files are keyed by their name and checksum, so a
+// replaced file is never read from the cache. Files being read are not evicted.
+type FileCache struct {
+	entries  map[string]*list.Element
+	fetching map[string]*sync.WaitGroup
+	logger   *zap.Logger
+	maxBytes int64
+	mutex    sync.Mutex
+	// order has the most recently used entry at the front
+	order *list.List
+	path  string
+	size  int64
+}
+
+type cacheEntry struct {
+	key  string
+	refs int
+	size int64
+}
+
+// NewFileCache keeps up to maxBytes of files in path, including those left from a previous run.
+func NewFileCache(path string, maxBytes int64, logger *zap.Logger) (*FileCache, error) {
+	err := os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cache directory: %w", err)
+	}
+
+	cache := &FileCache{
+		entries:  map[string]*list.Element{},
+		fetching: map[string]*sync.WaitGroup{},
+		logger:   logger,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		path:     path,
+	}
+
+	err = cache.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+// load adds the files already in the cache, the most recently modified first.
+func (c *FileCache) load() error {
+	dirEntries, err := os.ReadDir(c.path)
+	if err != nil {
+		return fmt.Errorf("could not read cache directory: %w", err)
+	}
+
+	infos := []os.FileInfo{}
+
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() {
+			continue
+		}
+
+		if strings.HasSuffix(dirEntry.Name(), cacheDownloadSuffix) {
+			_ = os.Remove(filepath.Join(c.path, dirEntry.Name()))
+
+			continue
+		}
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat cached file: %w", err)
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	for _, info := range infos {
+		c.entries[info.Name()] = c.order.PushBack(&cacheEntry{key: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+
+	c.evict()
+
+	return nil
+}
+
+// Get returns the filename of the cached file, calling fetch to download it
+// when it is not cached. Concurrent gets of the same file share one fetch.
+// The file is kept until release is called.
+func (c *FileCache) Get(name, checksum string, fetch func(filename string) error) (string, func(), error) {
+	key := checksum + "-" + name
+	filename := filepath.Join(c.path, key)
+
+	for {
+		c.mutex.Lock()
+
+		if element, ok := c.entries[key]; ok {
+			element.Value.(*cacheEntry).refs++
+			c.order.MoveToFront(element)
+			c.mutex.Unlock()
+
+			cacheHits.Inc()
+
+			return filename, c.release(key), nil
+		}
+
+		fetching, ok := c.fetching[key]
+		if !ok {
+			break
+		}
+
+		c.mutex.Unlock()
+		fetching.Wait()
+	}
+
+	fetching := &sync.WaitGroup{}
+	fetching.Add(1)
+	c.fetching[key] = fetching
+	c.mutex.Unlock()
+
+	cacheMisses.Inc()
+
+	size, err := c.fetch(filename, fetch)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.fetching, key)
+	fetching.Done()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, refs: 1, size: size})
+	c.size += size
+	c.evict()
+
+	return filename, c.release(key), nil
+}
+
+func (c *FileCache) fetch(filename string, fetch func(filename string) error) (int64, error) {
+	download := filename + cacheDownloadSuffix
+
+	err := fetch(download)
+	if err != nil {
+		_ = os.Remove(download)
+
+		return 0, err
+	}
+
+	info, err := os.Stat(download)
+	if err != nil {
+		return 0, fmt.Errorf("could not stat download: %w", err)
+	}
+
+	err = os.Rename(download, filename)
+	if err != nil {
+		return 0, fmt.Errorf("could not add to cache: %w", err)
+	}
+
+	return info.Size(), nil
+}
+
+func (c *FileCache) release(key string) func() {
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+
+			if element, ok := c.entries[key]; ok {
+				element.Value.(*cacheEntry).refs--
+			}
+
+			c.evict()
+		})
+	}
+}
+
+// evict removes the least recently used files not being read, until the cache fits.
+func (c *FileCache) evict() {
+	element := c.order.Back()
+
+	for element != nil && c.size > c.maxBytes {
+		previous := element.Prev()
+		entry := element.Value.(*cacheEntry)
+
+		if entry.refs == 0 {
+			err := os.Remove(filepath.Join(c.path, entry.key))
+			if err != nil && !os.IsNotExist(err) {
+				c.logger.Error("could not evict cached file", zap.String("key", entry.key), zap.Error(err))
+			}
+
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+			c.size -= entry.size
+
+			cacheEvictions.Inc()
+		}
+
+		element = previous
+	}
+
+	cacheBytes.Set(float64(c.size))
+}
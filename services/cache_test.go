@@ -0,0 +1,132 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("FileCache", func() {
+	var (
+		cachePath string
+		fetches   int32
+	)
+
+	fetch := func(size int) func(string) error {
+		return func(filename string) error {
+			atomic.AddInt32(&fetches, 1)
+
+			return os.WriteFile(filename, make([]byte, size), 0o600)
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		cachePath, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, cachePath)
+
+		fetches = 0
+	})
+
+	It("fetches a file once until its checksum changes", func() {
+		cache, err := services.NewFileCache(cachePath, 100, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		filename, release, err := cache.Get("1.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filename).To(BeAnExistingFile())
+		release()
+
+		_, release, err = cache.Get("1.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+		Expect(fetches).To(BeEquivalentTo(1))
+
+		_, release, err = cache.Get("1.db", "def", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+		Expect(fetches).To(BeEquivalentTo(2))
+	})
+
+	It("shares a fetch between concurrent gets", func() {
+		cache, err := services.NewFileCache(cachePath, 100, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				_, release, err := cache.Get("1.db", "abc", fetch(10))
+				Expect(err).NotTo(HaveOccurred())
+				release()
+			}()
+		}
+
+		wg.Wait()
+		Expect(fetches).To(BeEquivalentTo(1))
+	})
+
+	It("evicts the least recently used files that are not being read", func() {
+		cache, err := services.NewFileCache(cachePath, 25, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		first, releaseFirst, err := cache.Get("1.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+
+		second, releaseSecond, err := cache.Get("2.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		releaseSecond()
+
+		third, releaseThird, err := cache.Get("3.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		releaseThird()
+
+		Expect(first).To(BeAnExistingFile())
+		Expect(second).NotTo(BeAnExistingFile())
+		Expect(third).To(BeAnExistingFile())
+
+		releaseFirst()
+
+		_, release, err := cache.Get("4.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+
+		Expect(first).NotTo(BeAnExistingFile())
+		Expect(third).To(BeAnExistingFile())
+	})
+
+	It("keeps the files from a previous run", func() {
+		cache, err := services.NewFileCache(cachePath, 100, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, release, err := cache.Get("1.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+
+		err = os.WriteFile(filepath.Join(cachePath, "2.db.download"), nil, 0o600)
+		Expect(err).NotTo(HaveOccurred())
+
+		cache, err = services.NewFileCache(cachePath, 100, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(cachePath, "2.db.download")).NotTo(BeAnExistingFile())
+
+		_, release, err = cache.Get("1.db", "abc", fetch(10))
+		Expect(err).NotTo(HaveOccurred())
+		release()
+		Expect(fetches).To(BeEquivalentTo(1))
+	})
+})
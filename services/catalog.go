@@ -0,0 +1,395 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/c2fo/vfs/v6/vfssimple"
+)
+
+// catalogPath is the directory of the manifests, one for each persisted file,
+// and of the index folding them together.
+const catalogPath = "catalog"
+
+var manifestFilename = regexp.MustCompile(`^[^/]+\.db\.json$`)
+
+// Catalog is a manifest of the persisted files, stored alongside them,
+// so a query can be planned without opening every file.
+type Catalog struct {
+	Files []FileInfo `json:"files"`
+}
+
+// manifest is the catalog entry of one file, stored as its own object, so
+// adding or removing a file never rewrites the entries of the others.
+// Replaces are the files it was compacted from, left out of the catalog
+// from the moment the manifest is folded into the index, even before they
+// are deleted.
+type manifest struct {
+	FileInfo
+	Replaces []string `json:"replaces,omitempty"`
+}
+
+// Add records a file, replacing any previous entry with the same name.
+func (c *Catalog) Add(info FileInfo) {
+	c.Remove(info.Name)
+	c.Files = append(c.Files, info)
+
+	sort.Slice(c.Files, func(i, j int) bool {
+		return c.Files[i].Name < c.Files[j].Name
+	})
+}
+
+// Remove drops the entry for a file.
+func (c *Catalog) Remove(name string) {
+	files := c.Files[:0]
+
+	for _, file := range c.Files {
+		if file.Name != name {
+			files = append(files, file)
+		}
+	}
+
+	c.Files = files
+}
+
+// Filter returns the non-empty files with events in the time range.
+func (c *Catalog) Filter(timeRange TimeRange) []FileInfo {
+	files := []FileInfo{}
+
+	for _, file := range c.Files {
+		if file.Count > 0 && timeRange.Overlaps(file.MinTime, file.MaxTime) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// Catalog reads the index of the manifests, a single object, so planning a
+// query is one fetch. The index is built from the manifests when missing.
+// An empty catalog is returned when none has been written yet.
+func (p *Persistence) Catalog() (*Catalog, error) {
+	contents, ok, err := readObject(p.remoteURI(catalogPath + "/index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read catalog index: %w", err)
+	}
+
+	if !ok {
+		return p.foldCatalog()
+	}
+
+	catalog := &Catalog{Files: []FileInfo{}}
+
+	err = json.Unmarshal(contents, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse catalog index: %w", err)
+	}
+
+	return catalog, nil
+}
+
+// foldCatalog writes the index of every manifest, after a manifest is
+// written or deleted. As servers uploading at once can each overwrite the
+// index, the manifests are listed again once it is written, and it is
+// written again until none were added or removed in the meantime, so the
+// last index written has them all.
+func (p *Persistence) foldCatalog() (*Catalog, error) {
+	p.foldMutex.Lock()
+	defer p.foldMutex.Unlock()
+
+	manifests, err := p.loadManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		catalog := catalogOf(manifests)
+
+		contents, err := json.Marshal(catalog)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal catalog index: %w", err)
+		}
+
+		err = writeObject(p.remoteURI(catalogPath+"/index.json"), contents)
+		if err != nil {
+			return nil, fmt.Errorf("could not write catalog index: %w", err)
+		}
+
+		folded := manifests
+
+		manifests, err = p.loadManifests()
+		if err != nil {
+			return nil, err
+		}
+
+		if sameManifests(folded, manifests) {
+			return catalog, nil
+		}
+	}
+}
+
+// loadManifests lists the manifests in the remote location, reading only
+// those not read before, as a manifest is not changed once written.
+func (p *Persistence) loadManifests() (map[string]manifest, error) {
+	location, err := vfssimple.NewLocation(p.remoteURI(catalogPath + "/"))
+	if err != nil {
+		return nil, fmt.Errorf("could not reference catalog: %w", err)
+	}
+
+	names, err := location.ListByRegex(manifestFilename)
+	if err != nil {
+		return nil, fmt.Errorf("could not list catalog: %w", err)
+	}
+
+	manifests := map[string]manifest{}
+
+	for _, name := range names {
+		name = strings.TrimSuffix(name, ".json")
+
+		p.manifestsMutex.Lock()
+		entry, ok := p.manifests[name]
+		p.manifestsMutex.Unlock()
+
+		if !ok {
+			entry, ok, err = p.readManifest(name)
+			if err != nil {
+				return nil, err
+			}
+
+			// deleted since it was listed
+			if !ok {
+				continue
+			}
+		}
+
+		manifests[name] = entry
+	}
+
+	cached := make(map[string]manifest, len(manifests))
+	for name, entry := range manifests {
+		cached[name] = entry
+	}
+
+	p.manifestsMutex.Lock()
+	p.manifests = cached
+	p.manifestsMutex.Unlock()
+
+	return manifests, nil
+}
+
+// catalogOf the manifests leaves out the files replaced by a compaction.
+func catalogOf(manifests map[string]manifest) *Catalog {
+	replaced := map[string]bool{}
+
+	for _, entry := range manifests {
+		for _, name := range entry.Replaces {
+			replaced[name] = true
+		}
+	}
+
+	catalog := &Catalog{Files: []FileInfo{}}
+
+	for name, entry := range manifests {
+		if !replaced[name] {
+			catalog.Add(entry.FileInfo)
+		}
+	}
+
+	return catalog
+}
+
+func sameManifests(folded, listed map[string]manifest) bool {
+	if len(folded) != len(listed) {
+		return false
+	}
+
+	for name := range listed {
+		if _, ok := folded[name]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RebuildCatalog inspects every persisted file and replaces the manifests,
+// for buckets written before the catalog existed or after it was lost.
+// Files replaced by a compaction that stopped before deleting them are deleted.
+func (p *Persistence) RebuildCatalog(workPath string) (*Catalog, error) {
+	manifests, err := p.loadManifests()
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := map[string]bool{}
+
+	for _, entry := range manifests {
+		for _, name := range entry.Replaces {
+			replaced[name] = true
+		}
+	}
+
+	names, err := p.List()
+	if err != nil {
+		return nil, fmt.Errorf("could not list files: %w", err)
+	}
+
+	persisted := map[string]bool{}
+
+	for _, name := range names {
+		if replaced[name] {
+			err = p.Delete(name)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		info, err := p.inspectRemote(name, workPath)
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.writeManifest(manifest{FileInfo: *info})
+		if err != nil {
+			return nil, err
+		}
+
+		persisted[name] = true
+	}
+
+	for name := range manifests {
+		if !persisted[name] {
+			err = p.deleteManifest(name)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return p.foldCatalog()
+}
+
+func (p *Persistence) manifestURI(name string) string {
+	return p.remoteURI(fmt.Sprintf("%s/%s.json", catalogPath, name))
+}
+
+func (p *Persistence) readManifest(name string) (manifest, bool, error) {
+	entry := manifest{}
+
+	contents, ok, err := readObject(p.manifestURI(name))
+	if err != nil {
+		return entry, false, fmt.Errorf("could not read manifest %q: %w", name, err)
+	}
+
+	if !ok {
+		return entry, false, nil
+	}
+
+	err = json.Unmarshal(contents, &entry)
+	if err != nil {
+		return entry, false, fmt.Errorf("could not parse manifest %q: %w", name, err)
+	}
+
+	return entry, true, nil
+}
+
+// writeManifest records a file with a single write, so readers never see a
+// partially written entry. It is in the catalog once the index is folded.
+func (p *Persistence) writeManifest(entry manifest) error {
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest: %w", err)
+	}
+
+	err = writeObject(p.manifestURI(entry.Name), contents)
+	if err != nil {
+		return fmt.Errorf("could not write manifest: %w", err)
+	}
+
+	p.manifestsMutex.Lock()
+	p.manifests[entry.Name] = entry
+	p.manifestsMutex.Unlock()
+
+	return nil
+}
+
+// readObject is false when there is no object at the URI, or it is empty, as
+// the local file backend creates a file before it is written. It only checks
+// for the object when it cannot be read, so reading one is a single request.
+func readObject(uri string) ([]byte, bool, error) {
+	file, err := vfssimple.NewFile(uri)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not reference: %w", err)
+	}
+
+	contents, readErr := io.ReadAll(file)
+	_ = file.Close()
+
+	if readErr == nil {
+		return contents, len(contents) > 0, nil
+	}
+
+	exists, err := file.Exists()
+	if err != nil {
+		return nil, false, fmt.Errorf("could not check: %w", err)
+	}
+
+	if !exists {
+		return nil, false, nil
+	}
+
+	return nil, false, fmt.Errorf("could not read: %w", readErr)
+}
+
+func writeObject(uri string, contents []byte) error {
+	file, err := vfssimple.NewFile(uri)
+	if err != nil {
+		return fmt.Errorf("could not reference: %w", err)
+	}
+
+	_, err = file.Write(contents)
+	if err != nil {
+		_ = file.Close()
+
+		return fmt.Errorf("could not write: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("could not save: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Persistence) deleteManifest(name string) error {
+	file, err := vfssimple.NewFile(p.manifestURI(name))
+	if err != nil {
+		return fmt.Errorf("could not reference manifest: %w", err)
+	}
+
+	// files uploaded before the catalog existed have no manifest
+	exists, err := file.Exists()
+	if err != nil {
+		return fmt.Errorf("could not check manifest %q: %w", name, err)
+	}
+
+	if exists {
+		err = file.Delete()
+		if err != nil {
+			return fmt.Errorf("could not delete manifest %q: %w", name, err)
+		}
+	}
+
+	p.manifestsMutex.Lock()
+	delete(p.manifests, name)
+	p.manifestsMutex.Unlock()
+
+	return nil
+}
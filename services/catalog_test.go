@@ -0,0 +1,130 @@
+package services_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Catalog", func() {
+	var (
+		persistence *services.Persistence
+		remotePath  string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		remotePath, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		persistence = services.NewPersistence("file://"+remotePath, zap.NewNop())
+	})
+
+	It("is empty before any uploads", func() {
+		catalog, err := persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(BeEmpty())
+	})
+
+	It("records each uploaded file", func() {
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300)
+
+		catalog, err := persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(2))
+
+		file := catalog.Files[0]
+		Expect(file.Name).To(Equal("1.db"))
+		Expect(file.Count).To(BeEquivalentTo(2))
+		Expect(file.Size).To(BeNumerically(">", 0))
+		Expect(file.Checksum).To(HaveLen(64))
+		Expect(file.SchemaVersion).To(BeNumerically(">=", 1))
+		Expect(file.Labels).To(Equal(map[string]int64{"index": 2}))
+	})
+
+	It("removes deleted files", func() {
+		persistFile(persistence, "1.db", 100)
+		persistFile(persistence, "2.db", 300)
+
+		err := persistence.Delete("1.db")
+		Expect(err).NotTo(HaveOccurred())
+
+		catalog, err := persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(1))
+		Expect(catalog.Files[0].Name).To(Equal("2.db"))
+	})
+
+	It("is read from a single index of the manifests", func() {
+		persistFile(persistence, "1.db", 100)
+		persistFile(persistence, "2.db", 300)
+
+		manifests, err := filepath.Glob(filepath.Join(remotePath, "catalog", "*.db.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifests).To(HaveLen(2))
+
+		for _, manifest := range manifests {
+			Expect(os.Remove(manifest)).To(Succeed())
+		}
+
+		catalog, err := services.NewPersistence("file://"+remotePath, zap.NewNop()).Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(2))
+	})
+
+	It("keeps every file uploaded at once by several servers", func() {
+		servers := []*services.Persistence{
+			persistence,
+			services.NewPersistence("file://"+remotePath, zap.NewNop()),
+		}
+
+		var wg sync.WaitGroup
+
+		for index := 0; index < 10; index++ {
+			wg.Add(1)
+
+			go func(index int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				persistFile(servers[index%2], fmt.Sprintf("%d.db", index+1), int64(index))
+			}(index)
+		}
+
+		wg.Wait()
+
+		catalog, err := persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(10))
+	})
+
+	It("can be rebuilt from the files", func() {
+		persistFile(persistence, "1.db", 100)
+		persistFile(persistence, "2.db", 300)
+
+		err := os.RemoveAll(filepath.Join(remotePath, "catalog"))
+		Expect(err).NotTo(HaveOccurred())
+
+		catalog, err := services.NewPersistence("file://"+remotePath, zap.NewNop()).Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(BeEmpty())
+
+		catalog, err = persistence.RebuildCatalog(os.TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(2))
+
+		catalog, err = persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// Compactor merges small persisted files into larger ones, reducing the
+// number of files a query has to read.
+type Compactor struct {
+	logger      *zap.Logger
+	persistence *Persistence
+	workPath    string
+}
+
+func NewCompactor(
+	persistence *Persistence,
+	workPath string,
+	logger *zap.Logger,
+) *Compactor {
+	return &Compactor{
+		logger:      logger,
+		persistence: persistence,
+		workPath:    workPath,
+	}
+}
+
+// Plan groups consecutive files whose combined count stays within maxCount.
+// Groups with a single file are left out, as there is nothing to merge.
+func (c *Compactor) Plan(files []FileInfo, maxCount int64) [][]FileInfo {
+	groups := [][]FileInfo{}
+	current := []FileInfo{}
+	count := int64(0)
+
+	flush := func() {
+		if len(current) > 1 {
+			groups = append(groups, current)
+		}
+
+		current = []FileInfo{}
+		count = 0
+	}
+
+	for _, file := range files {
+		if count+file.Count > maxCount {
+			flush()
+		}
+
+		current = append(current, file)
+		count += file.Count
+	}
+
+	flush()
+
+	return groups
+}
+
+// Compact merges the files into a single new file, named by the range of
+// its events, uploads it in place of the originals in the catalog, and then
+// removes the originals from the remote location. Stopping at any point
+// leaves each event in the catalog once.
+func (c *Compactor) Compact(files []FileInfo) (string, error) {
+	dir, err := os.MkdirTemp(c.workPath, "compact-")
+	if err != nil {
+		return "", fmt.Errorf("could not create compaction directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := NewWriter(filepath.Join(dir, compactedName(files)), c.logger)
+	if err != nil {
+		return "", fmt.Errorf("could not create writer: %w", err)
+	}
+
+	for _, file := range files {
+		filename := filepath.Join(dir, file.Name)
+
+		err = c.persistence.Download(file.Name, filename)
+		if err != nil {
+			_ = writer.Close()
+
+			return "", fmt.Errorf("could not download: %w", err)
+		}
+
+		err = writer.Merge(filename)
+		if err != nil {
+			_ = writer.Close()
+
+			return "", fmt.Errorf("could not merge: %w", err)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", fmt.Errorf("could not close writer: %w", err)
+	}
+
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+
+	err = c.persistence.UploadReplacing(writer.Filename(), names)
+	if err != nil {
+		return "", fmt.Errorf("could not upload: %w", err)
+	}
+
+	for _, file := range files {
+		err = c.persistence.Delete(file.Name)
+		if err != nil {
+			return "", fmt.Errorf("could not remove compacted file: %w", err)
+		}
+	}
+
+	return filepath.Base(writer.Filename()), nil
+}
+
+// compactedName is the first and last times of the events in the files, so a
+// retried compaction of the same files replaces its earlier upload.
+func compactedName(files []FileInfo) string {
+	var first, last int64
+
+	counted := false
+
+	for _, file := range files {
+		if file.Count == 0 {
+			continue
+		}
+
+		if !counted || file.MinTime.UnixNano() < first {
+			first = file.MinTime.UnixNano()
+		}
+
+		if !counted || file.MaxTime.UnixNano() > last {
+			last = file.MaxTime.UnixNano()
+		}
+
+		counted = true
+	}
+
+	return fmt.Sprintf("%d-%d.db", first, last)
+}
@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Compactor", func() {
+	It("plans groups within the max count", func() {
+		compactor := services.NewCompactor(nil, "", zap.NewNop())
+
+		groups := compactor.Plan([]services.FileInfo{
+			{Name: "1.db", Count: 5},
+			{Name: "2.db", Count: 5},
+			{Name: "3.db", Count: 5},
+			{Name: "4.db", Count: 20},
+			{Name: "5.db", Count: 1},
+		}, 10)
+		Expect(groups).To(HaveLen(1))
+		Expect(groups[0]).To(HaveLen(2))
+		Expect(groups[0][0].Name).To(Equal("1.db"))
+		Expect(groups[0][1].Name).To(Equal("2.db"))
+	})
+
+	It("merges files and removes the originals", func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(remotePath)
+
+		persistence := services.NewPersistence("file://"+remotePath, zap.NewNop())
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300)
+
+		reader := services.NewReader(persistence, os.TempDir(), zap.NewNop())
+		files, err := reader.Files(services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+
+		compactor := services.NewCompactor(persistence, os.TempDir(), zap.NewNop())
+		name, err := compactor.Compact(files)
+		Expect(err).NotTo(HaveOccurred())
+
+		files, err = reader.Files(services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].Name).To(Equal(name))
+		Expect(files[0].Count).To(BeEquivalentTo(3))
+
+		Expect(name).To(Equal("100-300.db"))
+		Expect(filepath.Join(remotePath, "1.db")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(remotePath, "2.db")).NotTo(BeAnExistingFile())
+	})
+
+	It("never counts events twice when stopped before removing the originals", func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(remotePath)
+
+		persistence := services.NewPersistence("file://"+remotePath, zap.NewNop())
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300)
+
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(workPath)
+
+		merged, err := services.NewWriter(filepath.Join(workPath, "100-300.db"), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged.Merge(filepath.Join(remotePath, "1.db"))).To(Succeed())
+		Expect(merged.Merge(filepath.Join(remotePath, "2.db"))).To(Succeed())
+		Expect(merged.Close()).To(Succeed())
+
+		err = persistence.UploadReplacing(merged.Filename(), []string{"1.db", "2.db"})
+		Expect(err).NotTo(HaveOccurred())
+
+		catalog, err := persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(1))
+		Expect(catalog.Files[0].Count).To(BeEquivalentTo(3))
+
+		catalog, err = persistence.RebuildCatalog(workPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog.Files).To(HaveLen(1))
+		Expect(filepath.Join(remotePath, "1.db")).NotTo(BeAnExistingFile())
+	})
+})
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"go.uber.org/zap"
+)
+
+const (
+	dropSampleSize      = 100
+	dropWarningInterval = 10 * time.Second
+)
+
+// dropTracker keeps a sample of which label sets are being dropped
+// and warns about drops at most once per interval.
+type dropTracker struct {
+	interval     time.Duration
+	labels       map[string]uint64
+	lastWarning  time.Time
+	logger       *zap.Logger
+	mutex        sync.Mutex
+	sinceWarning uint64
+}
+
+func newDropTracker(logger *zap.Logger) *dropTracker {
+	return &dropTracker{
+		interval: dropWarningInterval,
+		labels:   map[string]uint64{},
+		logger:   logger,
+	}
+}
+
+func (d *dropTracker) record(event sdk.Event) {
+	bufferDropped.Inc()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := labelSet(event.Labels)
+	if _, ok := d.labels[key]; ok || len(d.labels) < dropSampleSize {
+		d.labels[key]++
+	}
+
+	d.sinceWarning++
+
+	if time.Since(d.lastWarning) >= d.interval {
+		fields := []zap.Field{zap.Uint64("dropped", d.sinceWarning)}
+
+		// the first warning has no previous one to count from
+		if !d.lastWarning.IsZero() {
+			fields = append(fields, zap.Duration("since", time.Since(d.lastWarning).Round(time.Second)))
+		}
+
+		d.logger.Warn("dropping events, the buffer is full", fields...)
+
+		d.lastWarning = time.Now()
+		d.sinceWarning = 0
+	}
+}
+
+// sample returns the number of drops for up to dropSampleSize label sets,
+// the first ones seen dropping.
+func (d *dropTracker) sample() map[string]uint64 {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	sample := make(map[string]uint64, len(d.labels))
+	for key, count := range d.labels {
+		sample[key] = count
+	}
+
+	return sample
+}
+
+// labelSet formats labels like a Prometheus selector, with sorted keys.
+func labelSet(labels sdk.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", key, labels[key]))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,19 @@
+package services
+
+import "github.com/jtarchie/sqlite-tsdb/sdk"
+
+const DBDriverName = dbDriverName
+
+const DBDriverKind = dbDriverKind
+
+var AllowStatement = allowStatement
+
+func (j *Jobs) Sweep() {
+	j.sweep()
+}
+
+var NewDropTracker = newDropTracker
+
+func (d *dropTracker) Record(event sdk.Event) {
+	d.record(event)
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrFunctionArguments is returned by the time series functions for arguments they cannot use.
+var ErrFunctionArguments = errors.New("invalid function arguments")
+
+// maxSeriesPoints bounds the array from time_series, as it is held in memory.
+const maxSeriesPoints = 100000
+
+// scalarFunction is a SQL function registered with each driver.
+type scalarFunction struct {
+	name string
+	args int
+	fn   func(args []any) (any, error)
+}
+
+// aggregateFunction is a SQL aggregate registered with each driver,
+// with an aggregator created for each group.
+type aggregateFunction struct {
+	name string
+	args int
+	new  func() aggregator
+}
+
+type aggregator interface {
+	step(args []any) error
+	value() (any, error)
+}
+
+var scalarFunctions = []scalarFunction{
+	{name: "time_bucket", args: 2, fn: timeBucket},
+	{name: "time_series", args: 3, fn: timeSeries},
+	{name: "label", args: 2, fn: label},
+	{name: "labels_match", args: 2, fn: labelsMatch},
+}
+
+var aggregateFunctions = []aggregateFunction{
+	{name: "rate", args: 2, new: func() aggregator { return &samples{result: rate} }},
+	{name: "delta", args: 2, new: func() aggregator { return &samples{result: delta} }},
+	{name: "interpolate", args: 3, new: func() aggregator { return &interpolation{} }},
+	{name: "percentile", args: 2, new: func() aggregator { return &percentile{} }},
+	{name: "median", args: 1, new: func() aggregator { return &percentile{rank: 50} }},
+}
+
+// functionError is the error of a query failing on a function's arguments,
+// which the sqlite drivers only keep the message of.
+type functionError struct {
+	err error
+}
+
+func (f functionError) Error() string { return f.err.Error() }
+
+func (f functionError) Unwrap() error { return f.err }
+
+func (f functionError) Is(target error) bool { return target == ErrFunctionArguments }
+
+// asFunctionError has errors from the arguments of the functions, including
+// label selectors, match ErrFunctionArguments once returned by the driver.
+func asFunctionError(err error) error {
+	if err == nil || errors.Is(err, ErrFunctionArguments) {
+		return err
+	}
+
+	message := err.Error()
+	if strings.Contains(message, ErrFunctionArguments.Error()) || strings.Contains(message, ErrLabelSelector.Error()) {
+		return functionError{err: err}
+	}
+
+	return err
+}
+
+func checkArgs(name string, want int, args []any) error {
+	if len(args) != want {
+		return fmt.Errorf("%w: %s takes %d arguments, got %d", ErrFunctionArguments, name, want, len(args))
+	}
+
+	return nil
+}
+
+// timeBucket rounds a timestamp in nanoseconds down to a multiple of the
+// width, given in nanoseconds or as a duration like '5m'.
+func timeBucket(args []any) (any, error) {
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	timestamp, ok := toInt(args[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: time_bucket timestamp must be an integer", ErrFunctionArguments)
+	}
+
+	width, err := toDuration(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := timestamp - timestamp%width
+	if timestamp%width < 0 {
+		bucket -= width
+	}
+
+	return bucket, nil
+}
+
+// timeSeries returns a JSON array of the timestamps from start to end, a step
+// apart, to fill gaps by joining with json_each.
+func timeSeries(args []any) (any, error) {
+	start, startOK := toInt(args[0])
+	end, endOK := toInt(args[1])
+
+	if !startOK || !endOK {
+		return nil, fmt.Errorf("%w: time_series start and end must be integers", ErrFunctionArguments)
+	}
+
+	step, err := toDuration(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := seriesPoints("time_series", start, end, step)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]int64, 0, count)
+	for index := int64(0); index < count; index++ {
+		points = append(points, start+index*step)
+	}
+
+	contents, err := json.Marshal(points)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode time series: %w", err)
+	}
+
+	return string(contents), nil
+}
+
+// seriesPoints is the number of timestamps from start to end, a step apart.
+// The span is unsigned, as it can be more than the largest int64.
+func seriesPoints(name string, start, end, step int64) (int64, error) {
+	if end < start {
+		return 0, nil
+	}
+
+	steps := (uint64(end) - uint64(start)) / uint64(step)
+	if steps >= maxSeriesPoints {
+		return 0, fmt.Errorf("%w: %s is limited to %d points", ErrFunctionArguments, name, maxSeriesPoints)
+	}
+
+	return int64(steps) + 1, nil
+}
+
+type sample struct {
+	timestamp int64
+	value     float64
+}
+
+// samples collects the (timestamp, value) rows of a group, ordered by
+// timestamp for the result, as the rows of a group can be in any order.
+// Non-numeric values are ignored.
+type samples struct {
+	points []sample
+	result func(points []sample) any
+}
+
+func (s *samples) step(args []any) error {
+	timestamp, timestampOK := toInt(args[0])
+	value, valueOK := toFloat(args[1])
+
+	if timestampOK && valueOK {
+		s.points = append(s.points, sample{timestamp: timestamp, value: value})
+	}
+
+	return nil
+}
+
+func (s *samples) sorted() []sample {
+	sort.SliceStable(s.points, func(i, j int) bool {
+		return s.points[i].timestamp < s.points[j].timestamp
+	})
+
+	return s.points
+}
+
+func (s *samples) value() (any, error) {
+	return s.result(s.sorted()), nil
+}
+
+// rate is the per-second increase of a counter, treating a decrease as the
+// counter being reset, like PromQL's rate without extrapolation.
+func rate(points []sample) any {
+	if len(points) < 2 { //nolint: gomnd
+		return nil
+	}
+
+	first, last := points[0], points[len(points)-1]
+	if last.timestamp == first.timestamp {
+		return nil
+	}
+
+	increase := 0.0
+
+	for index := 1; index < len(points); index++ {
+		if points[index].value < points[index-1].value {
+			increase += points[index].value
+		} else {
+			increase += points[index].value - points[index-1].value
+		}
+	}
+
+	return increase / time.Duration(last.timestamp-first.timestamp).Seconds()
+}
+
+// delta is the difference between the last and first values, like PromQL's delta for gauges.
+func delta(points []sample) any {
+	if len(points) < 2 { //nolint: gomnd
+		return nil
+	}
+
+	return points[len(points)-1].value - points[0].value
+}
+
+// interpolation is the value at a time, given as the first argument, linearly
+// between the samples around it, or the nearest sample when it is outside them.
+type interpolation struct {
+	samples
+	at     int64
+	atSeen bool
+}
+
+func (i *interpolation) step(args []any) error {
+	at, ok := toInt(args[0])
+	if !ok {
+		return fmt.Errorf("%w: interpolate time must be an integer", ErrFunctionArguments)
+	}
+
+	if i.atSeen && at != i.at {
+		return fmt.Errorf("%w: interpolate time must be the same for the group", ErrFunctionArguments)
+	}
+
+	i.at, i.atSeen = at, true
+
+	return i.samples.step(args[1:])
+}
+
+func (i *interpolation) value() (any, error) {
+	points := i.sorted()
+	if len(points) == 0 {
+		return nil, nil
+	}
+
+	index := sort.Search(len(points), func(j int) bool {
+		return points[j].timestamp >= i.at
+	})
+
+	switch {
+	case index == len(points):
+		return points[len(points)-1].value, nil
+	case index == 0 || points[index].timestamp == i.at:
+		return points[index].value, nil
+	}
+
+	before, after := points[index-1], points[index]
+	fraction := float64(i.at-before.timestamp) / float64(after.timestamp-before.timestamp)
+
+	return before.value + (after.value-before.value)*fraction, nil
+}
+
+// percentile is the value at a rank from 0 to 100, linearly between the
+// values around it. Non-numeric values are ignored. median has no rank argument.
+type percentile struct {
+	rank   float64
+	ranked bool
+	values []float64
+}
+
+func (p *percentile) step(args []any) error {
+	if len(args) == 2 { //nolint: gomnd
+		rank, ok := toFloat(args[1])
+		if !ok || rank < 0 || rank > 100 {
+			return fmt.Errorf("%w: percentile must be from 0 to 100", ErrFunctionArguments)
+		}
+
+		if p.ranked && rank != p.rank {
+			return fmt.Errorf("%w: percentile must be the same for the group", ErrFunctionArguments)
+		}
+
+		p.rank, p.ranked = rank, true
+	}
+
+	if value, ok := toFloat(args[0]); ok {
+		p.values = append(p.values, value)
+	}
+
+	return nil
+}
+
+func (p *percentile) value() (any, error) {
+	if len(p.values) == 0 {
+		return nil, nil
+	}
+
+	sort.Float64s(p.values)
+
+	position := p.rank / 100 * float64(len(p.values)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+
+	return p.values[lower] + (p.values[upper]-p.values[lower])*(position-float64(lower)), nil
+}
+
+func toInt(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return value, true
+	case float64:
+		return int64(value), true
+	case string:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+
+		return parsed, err == nil
+	case []byte:
+		return toInt(string(value))
+	default:
+		return 0, false
+	}
+}
+
+// toFloat converts numbers, including those in text as the JSON of the value column.
+func toFloat(value any) (float64, bool) {
+	switch value := value.(type) {
+	case int64:
+		return float64(value), true
+	case float64:
+		return value, true
+	case string:
+		parsed, err := strconv.ParseFloat(strings.Trim(value, `"`), 64)
+
+		return parsed, err == nil
+	case []byte:
+		return toFloat(string(value))
+	default:
+		return 0, false
+	}
+}
+
+// toDuration is nanoseconds from a number, or a duration like '5m', '1h30m' or PromQL's '1d' and '1w'.
+func toDuration(value any) (int64, error) {
+	var width int64
+
+	switch value := value.(type) {
+	case int64:
+		width = value
+	case float64:
+		width = int64(value)
+	case string:
+		duration, err := parseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+
+		width = int64(duration)
+	}
+
+	if width <= 0 {
+		return 0, fmt.Errorf("%w: %v is not a positive duration", ErrFunctionArguments, value)
+	}
+
+	return width, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,     //nolint: gomnd
+		"w": 7 * 24 * time.Hour, //nolint: gomnd
+	}
+
+	if value != "" {
+		if unit, ok := units[value[len(value)-1:]]; ok {
+			count, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+			if err == nil {
+				return time.Duration(count) * unit, nil
+			}
+		}
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a duration", ErrFunctionArguments, value)
+	}
+
+	return duration, nil
+}
@@ -0,0 +1,124 @@
+package services_test
+
+import (
+	"database/sql"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Time series functions", func() {
+	var db *sql.DB
+
+	BeforeEach(func() {
+		var err error
+
+		db, err = sql.Open(services.DBDriverName, ":memory:")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(db.Close)
+	})
+
+	// samples are a counter that resets, one second apart
+	const samples = `WITH samples (timestamp, value) AS (VALUES
+		(3000000000, '3'), (1000000000, '1'), (2000000000, '2.5'), (4000000000, '1'), (5000000000, '"not a number"')
+	) `
+
+	value := func(query string) any {
+		var result any
+
+		err := db.QueryRow(query).Scan(&result)
+		Expect(err).NotTo(HaveOccurred())
+
+		return result
+	}
+
+	DescribeTable("computes values",
+		func(query string, expected any) {
+			Expect(value(query)).To(BeEquivalentTo(expected))
+		},
+		Entry("time_bucket with a duration", "SELECT time_bucket(330000000000, '5m')", 300000000000),
+		Entry("time_bucket with nanoseconds", "SELECT time_bucket(25, 10)", 20),
+		Entry("time_bucket with real nanoseconds", "SELECT time_bucket(330, 300.0)", 300),
+		Entry("time_bucket before the epoch", "SELECT time_bucket(-5, 10)", -10),
+		Entry("time_bucket with days", "SELECT time_bucket(90000000000000, '1d')", 86400000000000),
+		Entry("time_series", "SELECT time_series(0, 25, 10)", "[0,10,20]"),
+		Entry("time_series up to the largest time", "SELECT time_series(9223372036854775607, 9223372036854775807, 100)", "[9223372036854775607,9223372036854775707,9223372036854775807]"),
+		Entry("time_series from the smallest time", "SELECT time_series(-9223372036854775808, -9223372036854775708, 50)", "[-9223372036854775808,-9223372036854775758,-9223372036854775708]"),
+		Entry("gap filling with time_series", "SELECT COUNT(*) FROM json_each(time_series(0, 3600000000000, '1m'))", 61),
+		Entry("rate across a counter reset", samples+"SELECT rate(timestamp, value) FROM samples", 1),
+		Entry("delta", samples+"SELECT delta(timestamp, value) FROM samples", 0),
+		Entry("interpolate between samples", samples+"SELECT interpolate(1500000000, timestamp, value) FROM samples", 1.75),
+		Entry("interpolate after the samples", samples+"SELECT interpolate(9000000000, timestamp, value) FROM samples", 1),
+		Entry("percentile", samples+"SELECT percentile(value, 50) FROM samples", 1.75),
+		Entry("percentile maximum", samples+"SELECT percentile(value, 100) FROM samples", 3),
+		Entry("median", samples+"SELECT median(value) FROM samples", 1.75),
+		Entry("label", `SELECT label('{"labels":{"a":"b"}}', 'a')`, "b"),
+		Entry("labels_match", `SELECT labels_match('{"labels":{"a":"bc"}}', '{a=~"b.*", d!="e"}')`, 1),
+		Entry("labels_match without a match", `SELECT labels_match('{"labels":{"a":"bc"}}', '{a="b"}')`, 0),
+		Entry("rate by time bucket", samples+"SELECT rate(timestamp, value) FROM samples GROUP BY time_bucket(timestamp, '2s') ORDER BY 1 DESC LIMIT 1", 0.5),
+	)
+
+	It("returns NULL without enough samples", func() {
+		Expect(value("SELECT rate(1, '1')")).To(BeNil())
+		Expect(value("SELECT median(NULL)")).To(BeNil())
+		Expect(value(`SELECT label('{"labels":{}}', 'a')`)).To(BeNil())
+	})
+
+	DescribeTable("refuses invalid arguments",
+		func(query string) {
+			var result any
+
+			err := db.QueryRow(query).Scan(&result)
+			Expect(err).To(MatchError(ContainSubstring("invalid function arguments")))
+		},
+		Entry("a bad duration", "SELECT time_bucket(1, '5 minutes')"),
+		Entry("a zero width", "SELECT time_bucket(1, 0)"),
+		Entry("too many points", "SELECT time_series(0, 1000000000000000, 1)"),
+		Entry("too many points across every time", "SELECT time_series(-9223372036854775808, 9223372036854775807, 1000000000)"),
+		Entry("a percentile out of range", "SELECT percentile(1, 101)"),
+	)
+
+	It("refuses an invalid label selector", func() {
+		var result any
+
+		err := db.QueryRow(`SELECT labels_match('{}', '{a=1}')`).Scan(&result)
+		Expect(err).To(MatchError(ContainSubstring("invalid label selector")))
+	})
+
+	Describe("generate_series", func() {
+		BeforeEach(func() {
+			if services.DBDriverKind != "cgo" {
+				Skip("the pure Go driver has no virtual tables")
+			}
+		})
+
+		It("has a row for each step", func() {
+			Expect(value("SELECT group_concat(value) FROM generate_series(0, 25, 10)")).To(Equal("0,10,20"))
+			Expect(value("SELECT COUNT(*) FROM generate_series(0, 3600000000000, '1m')")).To(BeEquivalentTo(61))
+			Expect(value("SELECT COUNT(*) FROM generate_series(10, 0, 1)")).To(BeEquivalentTo(0))
+			Expect(value("SELECT MAX(value) FROM generate_series(9223372036854775707, 9223372036854775807, 100)")).To(BeEquivalentTo(int64(9223372036854775807)))
+			Expect(value("SELECT MIN(value) FROM generate_series(-9223372036854775808, -9223372036854775708, 100)")).To(BeEquivalentTo(int64(-9223372036854775808)))
+			Expect(value("SELECT group_concat(value) FROM generate_series WHERE step = 300.0 AND stop = 600 AND start = 0")).To(Equal("0,300,600"))
+		})
+
+		It("fills gaps with a join", func() {
+			Expect(value(`SELECT group_concat(COALESCE(samples.column2, 0)) FROM generate_series(0, 30, 10) AS series
+				LEFT JOIN (VALUES (10, 1), (30, 3)) AS samples ON samples.column1 = series.value`)).To(Equal("0,1,0,3"))
+		})
+
+		DescribeTable("refuses invalid arguments",
+			func(query string) {
+				var result any
+
+				err := db.QueryRow(query).Scan(&result)
+				Expect(err).To(MatchError(ContainSubstring("invalid function arguments")))
+			},
+			Entry("a missing step", "SELECT value FROM generate_series(0, 10)"),
+			Entry("a zero step", "SELECT value FROM generate_series(0, 10, 0)"),
+			Entry("too many points", "SELECT value FROM generate_series(0, 1000000000000000, 1)"),
+			Entry("too many points across every time", "SELECT value FROM generate_series(-9223372036854775808, 9223372036854775807, 1000000000)"),
+		)
+	})
+})
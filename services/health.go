@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/c2fo/vfs/v6/vfssimple"
+)
+
+var ErrRemoteMissing = errors.New("remote location does not exist")
+
+// CheckWritable verifies a file can be created in the directory.
+func CheckWritable(path string) error {
+	file, err := os.CreateTemp(path, "health-")
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("could not close file: %w", err)
+	}
+
+	err = os.Remove(file.Name())
+	if err != nil {
+		return fmt.Errorf("could not remove file: %w", err)
+	}
+
+	return nil
+}
+
+// CheckWriter verifies the active writer's database is open.
+func (s *Switcher) CheckWriter() error {
+	err := s.writer.Load().db.Ping()
+	if err != nil {
+		return fmt.Errorf("active writer is not open: %w", err)
+	}
+
+	return nil
+}
+
+// CheckPending verifies fewer than max databases are waiting to be finalized.
+func (s *Switcher) CheckPending(max int64) error {
+	pending := atomic.LoadInt64(&s.pending)
+	if pending >= max {
+		return fmt.Errorf("%d databases waiting to be finalized, limit is %d", pending, max)
+	}
+
+	return nil
+}
+
+// CheckRemote verifies the remote location can be reached.
+func (p *Persistence) CheckRemote() error {
+	location, err := vfssimple.NewLocation(p.remoteURI(""))
+	if err != nil {
+		return fmt.Errorf("could not reference remote location: %w", err)
+	}
+
+	exists, err := location.Exists()
+	if err != nil {
+		return fmt.Errorf("could not reach remote location: %w", err)
+	}
+
+	if !exists {
+		return ErrRemoteMissing
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Health checks", func() {
+	var workPath string
+
+	BeforeEach(func() {
+		var err error
+
+		workPath, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, workPath)
+	})
+
+	It("checks the work path is writable", func() {
+		Expect(services.CheckWritable(workPath)).To(Succeed())
+		Expect(services.CheckWritable(filepath.Join(workPath, "missing"))).NotTo(Succeed())
+	})
+
+	It("checks the remote location exists", func() {
+		persistence := services.NewPersistence("file://"+workPath, zap.NewNop())
+		Expect(persistence.CheckRemote()).To(Succeed())
+
+		persistence = services.NewPersistence("file://"+filepath.Join(workPath, "missing"), zap.NewNop())
+		Expect(persistence.CheckRemote()).To(MatchError(services.ErrRemoteMissing))
+	})
+
+	It("checks the writer and finalize queue", func() {
+		switcher, err := services.NewSwitcher(workPath, 10, 10, services.Overflow{}, services.FinalizerWrap(func(string) {}), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(switcher.CheckWriter()).To(Succeed())
+		Expect(switcher.CheckPending(1)).To(Succeed())
+		Expect(switcher.CheckPending(0)).NotTo(Succeed())
+
+		Expect(switcher.Close()).To(Succeed())
+		Expect(switcher.CheckWriter()).NotTo(Succeed())
+	})
+
+})
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileInfo describes a persisted database file.
+type FileInfo struct {
+	Name          string           `json:"name"`
+	Size          int64            `json:"size"`
+	Count         int64            `json:"count"`
+	MinTime       time.Time        `json:"min_time"`
+	MaxTime       time.Time        `json:"max_time"`
+	Checksum      string           `json:"checksum"`
+	SchemaVersion int              `json:"schema_version"`
+	Labels        map[string]int64 `json:"labels"`
+	// LabelBloom is the file's bloom filter of labels, empty for files written before them.
+	LabelBloom string `json:"label_bloom,omitempty"`
+}
+
+// Inspect opens a local database file read-only and summarizes its contents.
+// Labels holds the number of distinct values for each label key.
+func Inspect(filename string) (*FileInfo, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not stat %q: %w", filename, err)
+	}
+
+	checksum, err := checksumFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openReadOnly(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	info := &FileInfo{
+		Name:     filepath.Base(filename),
+		Size:     stat.Size(),
+		Checksum: checksum,
+		Labels:   map[string]int64{},
+	}
+
+	var min, max sql.NullInt64
+
+	err = db.QueryRow(`
+		SELECT
+			COUNT(*),
+			MIN(payload->>'$.time'),
+			MAX(payload->>'$.time')
+		FROM payloads;
+	`).Scan(&info.Count, &min, &max)
+	if err != nil {
+		return nil, fmt.Errorf("could not summarize %q: %w", filename, err)
+	}
+
+	info.MinTime = time.Unix(0, min.Int64).UTC()
+	info.MaxTime = time.Unix(0, max.Int64).UTC()
+
+	info.SchemaVersion, err = schemaVersion(db)
+	if err != nil {
+		return nil, fmt.Errorf("could not read schema version %q: %w", filename, err)
+	}
+
+	err = inspectLabels(db, info.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("could not summarize labels %q: %w", filename, err)
+	}
+
+	err = db.QueryRow(`
+		SELECT COALESCE(MAX(value), '') FROM metadata
+		WHERE id = (SELECT MAX(id) FROM metadata WHERE key = 'label_bloom');
+	`).Scan(&info.LabelBloom)
+	if err != nil {
+		return nil, fmt.Errorf("could not read label bloom filter %q: %w", filename, err)
+	}
+
+	return info, nil
+}
+
+func inspectLabels(db *sql.DB, labels map[string]int64) error {
+	rows, err := db.Query(`
+		SELECT labels.key, COUNT(DISTINCT labels.value)
+		FROM payloads, json_each(payloads.payload, '$.labels') AS labels
+		WHERE labels.key IS NOT NULL
+		GROUP BY labels.key;
+	`)
+	if err != nil {
+		return fmt.Errorf("could not query labels: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key   string
+			count int64
+		)
+
+		err = rows.Scan(&key, &count)
+		if err != nil {
+			return fmt.Errorf("could not scan label: %w", err)
+		}
+
+		labels[key] = count
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("could not read labels: %w", err)
+	}
+
+	return nil
+}
+
+func checksumFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("could not open %q: %w", filename, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("could not checksum %q: %w", filename, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func openReadOnly(filename string) (*sql.DB, error) {
+	db, err := sql.Open(dbDriverName, fmt.Sprintf("file:%s?mode=ro", filename))
+	if err != nil {
+		return nil, fmt.Errorf("could not open sqlite db %q: %w", filename, err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// JobStatus is where a query job is in its life.
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+var (
+	ErrJobNotFound    = errors.New("query job not found")
+	ErrJobNotFinished = errors.New("query job has no results")
+	ErrTooManyJobs    = errors.New("too many query jobs running")
+)
+
+// sweepInterval is how often expired results are removed, or the time to live when shorter.
+const sweepInterval = time.Minute
+
+// Job is a snapshot of a query run in the background.
+type Job struct {
+	ID    string
+	Owner string
+	Query string
+
+	Status     JobStatus
+	FilesDone  int
+	FilesTotal int
+	Rows       int64
+	Error      string
+
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Jobs runs queries in the background, writing their rows to a sqlite file
+// in a directory, for queries that take longer than a request can wait.
+// At most maxRunning jobs run at once, unlimited when 0.
+// Finished jobs, and their results, are removed after a time to live, or
+// kept until deleted when it is 0.
+type Jobs struct {
+	cancels    map[string]context.CancelFunc
+	done       chan struct{}
+	jobs       map[string]*Job
+	logger     *zap.Logger
+	maxRunning int
+	mutex      sync.Mutex
+	path       string
+	reader     *Reader
+	ttl        time.Duration
+}
+
+// NewJobs stores results in path, and removes expired results until closed.
+// Everything in path is removed first, as the jobs of a previous run are
+// not known, so results never survive a restart.
+func NewJobs(
+	reader *Reader,
+	path string,
+	ttl time.Duration,
+	maxRunning int,
+	logger *zap.Logger,
+) (*Jobs, error) {
+	err := os.RemoveAll(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not remove previous results: %w", err)
+	}
+
+	err = os.MkdirAll(path, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("could not create results directory: %w", err)
+	}
+
+	jobs := &Jobs{
+		cancels:    map[string]context.CancelFunc{},
+		done:       make(chan struct{}),
+		jobs:       map[string]*Job{},
+		logger:     logger,
+		maxRunning: maxRunning,
+		path:       path,
+		reader:     reader,
+		ttl:        ttl,
+	}
+
+	go jobs.sweepEvery()
+
+	return jobs, nil
+}
+
+// Close stops removing expired results, and cancels the running jobs.
+func (j *Jobs) Close() {
+	close(j.done)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	for _, cancel := range j.cancels {
+		cancel()
+	}
+}
+
+// Submit plans the query then runs it in the background, unless too many jobs are running.
+func (j *Jobs) Submit(owner string, query string, timeRange TimeRange) (Job, error) {
+	err := singleStatement(query)
+	if err != nil {
+		return Job{}, err
+	}
+
+	plan, err := j.reader.Plan(query, timeRange)
+	if err != nil {
+		return Job{}, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:         id,
+		Owner:      owner,
+		Query:      query,
+		Status:     JobRunning,
+		FilesTotal: len(plan.Files) + len(plan.Local),
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	j.mutex.Lock()
+
+	if j.maxRunning > 0 && len(j.cancels) >= j.maxRunning {
+		j.mutex.Unlock()
+
+		return Job{}, fmt.Errorf("%w: the limit is %d", ErrTooManyJobs, j.maxRunning)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	j.jobs[id] = job
+	j.cancels[id] = cancel
+	snapshot := *job
+	j.mutex.Unlock()
+
+	queryJobsRunning.Inc()
+
+	go j.run(ctx, job, plan)
+
+	return snapshot, nil
+}
+
+// Get returns a snapshot of the job.
+func (j *Jobs) Get(id string) (Job, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+
+	return *job, nil
+}
+
+// Delete cancels a running job, or removes a finished one with its results.
+func (j *Jobs) Delete(id string) error {
+	j.mutex.Lock()
+
+	if _, ok := j.jobs[id]; !ok {
+		j.mutex.Unlock()
+
+		return ErrJobNotFound
+	}
+
+	if cancel, running := j.cancels[id]; running {
+		j.mutex.Unlock()
+		cancel()
+
+		return nil
+	}
+
+	delete(j.jobs, id)
+	j.mutex.Unlock()
+
+	return j.removeResults(id)
+}
+
+// Results calls fn with each row of a succeeded job.
+func (j *Jobs) Results(id string, fn RowFunc) error {
+	job, err := j.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if job.Status != JobSucceeded {
+		return fmt.Errorf("%w: it is %s", ErrJobNotFinished, job.Status)
+	}
+
+	db, err := sql.Open(dbDriverName, readOnlyURI(j.filename(id)))
+	if err != nil {
+		return fmt.Errorf("could not open results: %w", err)
+	}
+	defer db.Close()
+
+	columns := []string{}
+
+	rows, err := db.Query(`SELECT name FROM columns ORDER BY position;`)
+	if err != nil {
+		return fmt.Errorf("could not read columns: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var column string
+
+		err = rows.Scan(&column)
+		if err != nil {
+			return fmt.Errorf("could not read column: %w", err)
+		}
+
+		columns = append(columns, column)
+	}
+
+	if len(columns) == 0 {
+		return nil
+	}
+
+	results, err := db.Query(`SELECT * FROM results ORDER BY rowid;`)
+	if err != nil {
+		return fmt.Errorf("could not read results: %w", err)
+	}
+	defer results.Close()
+
+	return scanRows(results, func(_ []string, values []any) error {
+		return fn(columns, values)
+	})
+}
+
+func (j *Jobs) run(ctx context.Context, job *Job, plan Plan) {
+	logger := j.logger.With(zap.String("job", job.ID))
+	logger.Info("starting query job")
+
+	rows, err := j.execute(ctx, job, plan)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	delete(j.cancels, job.ID)
+
+	job.Rows = rows
+	job.FinishedAt = time.Now().UTC()
+
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		job.Status = JobCancelled
+	case err != nil:
+		job.Status = JobFailed
+		job.Error = err.Error()
+	default:
+		job.Status = JobSucceeded
+	}
+
+	if job.Status != JobSucceeded {
+		_ = j.removeResults(job.ID)
+	}
+
+	queryJobsRunning.Dec()
+	queryJobs.WithLabelValues(string(job.Status)).Inc()
+	logger.Info("finished query job", zap.String("status", string(job.Status)), zap.Error(err))
+}
+
+// execute writes the rows of the query to the job's results file, a
+// results table with a column per result column, named in the columns table.
+func (j *Jobs) execute(ctx context.Context, job *Job, plan Plan) (int64, error) {
+	db, err := sql.Open(dbDriverName, j.filename(job.ID))
+	if err != nil {
+		return 0, fmt.Errorf("could not create results: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not begin results: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	_, err = tx.Exec(`CREATE TABLE columns (position INTEGER PRIMARY KEY, name TEXT NOT NULL);`)
+	if err != nil {
+		return 0, fmt.Errorf("could not create columns: %w", err)
+	}
+
+	var (
+		insert *sql.Stmt
+		rows   int64
+	)
+
+	ctx = WithProgress(ctx, func(done, _ int) {
+		j.mutex.Lock()
+		job.FilesDone = done
+		j.mutex.Unlock()
+	})
+
+	err = j.reader.Execute(ctx, plan, job.Query, func(columns []string, values []any) error {
+		if insert == nil {
+			var err error
+
+			insert, err = createResults(tx, columns)
+			if err != nil {
+				return err
+			}
+		}
+
+		if values == nil {
+			return nil
+		}
+
+		_, err := insert.Exec(values...)
+		if err != nil {
+			return fmt.Errorf("could not write result: %w", err)
+		}
+
+		rows++
+
+		return nil
+	})
+	if err != nil {
+		return rows, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return rows, fmt.Errorf("could not commit results: %w", err)
+	}
+
+	return rows, nil
+}
+
+// createResults names the columns by position, as a query's column names need not be unique.
+func createResults(tx *sql.Tx, columns []string) (*sql.Stmt, error) {
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+
+	for index, column := range columns {
+		_, err := tx.Exec(`INSERT INTO columns (position, name) VALUES (?, ?);`, index, column)
+		if err != nil {
+			return nil, fmt.Errorf("could not write column: %w", err)
+		}
+
+		names[index] = fmt.Sprintf("c%d", index)
+		placeholders[index] = "?"
+	}
+
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE results (%s);`, strings.Join(names, ", ")))
+	if err != nil {
+		return nil, fmt.Errorf("could not create results table: %w", err)
+	}
+
+	insert, err := tx.Prepare(fmt.Sprintf(`INSERT INTO results VALUES (%s);`, strings.Join(placeholders, ", ")))
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare results insert: %w", err)
+	}
+
+	return insert, nil
+}
+
+func (j *Jobs) sweepEvery() {
+	interval := sweepInterval
+	if j.ttl > 0 && j.ttl < interval {
+		interval = j.ttl
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.sweep()
+		case <-j.done:
+			return
+		}
+	}
+}
+
+// sweep removes the jobs that finished longer ago than the time to live.
+func (j *Jobs) sweep() {
+	if j.ttl <= 0 {
+		return
+	}
+
+	expired := []string{}
+
+	j.mutex.Lock()
+
+	for id, job := range j.jobs {
+		if !job.FinishedAt.IsZero() && time.Since(job.FinishedAt) > j.ttl {
+			delete(j.jobs, id)
+			expired = append(expired, id)
+		}
+	}
+
+	j.mutex.Unlock()
+
+	for _, id := range expired {
+		err := j.removeResults(id)
+		if err != nil {
+			j.logger.Error("could not remove expired results", zap.String("job", id), zap.Error(err))
+		}
+	}
+}
+
+func (j *Jobs) removeResults(id string) error {
+	err := os.Remove(j.filename(id))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove results: %w", err)
+	}
+
+	return nil
+}
+
+func (j *Jobs) filename(id string) string {
+	return filepath.Join(j.path, id+".db")
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 16) //nolint: gomnd
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", fmt.Errorf("could not generate job ID: %w", err)
+	}
+
+	return hex.EncodeToString(id), nil
+}
@@ -0,0 +1,214 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Jobs", func() {
+	var (
+		jobs       *services.Jobs
+		resultPath string
+	)
+
+	BeforeEach(func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, workPath)
+
+		persistence := services.NewPersistence("file://"+remotePath, zap.NewNop())
+		reader := services.NewReader(persistence, workPath, zap.NewNop())
+
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300, 400, 500)
+
+		resultPath = filepath.Join(workPath, "queries")
+		jobs, err = services.NewJobs(reader, resultPath, time.Hour, 1, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(jobs.Close)
+	})
+
+	finished := func(id string) services.Job {
+		var job services.Job
+
+		Eventually(func() services.JobStatus {
+			var err error
+
+			job, err = jobs.Get(id)
+			Expect(err).NotTo(HaveOccurred())
+
+			return job.Status
+		}).ShouldNot(Equal(services.JobRunning))
+
+		return job
+	}
+
+	It("runs a query in the background and keeps its results", func() {
+		job, err := jobs.Submit("someone", "SELECT timestamp AS x, value AS x FROM payloads ORDER BY timestamp", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(job.Status).To(Equal(services.JobRunning))
+		Expect(job.FilesTotal).To(Equal(2))
+		Expect(job.Owner).To(Equal("someone"))
+
+		job = finished(job.ID)
+		Expect(job.Status).To(Equal(services.JobSucceeded))
+		Expect(job.FilesDone).To(Equal(2))
+		Expect(job.Rows).To(BeEquivalentTo(5))
+		Expect(job.FinishedAt).NotTo(BeZero())
+
+		rows := [][]any{}
+		err = jobs.Results(job.ID, func(columns []string, values []any) error {
+			Expect(columns).To(Equal([]string{"x", "x"}))
+			rows = append(rows, values)
+
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows).To(HaveLen(5))
+		Expect(rows[0]).To(Equal([]any{int64(100), `"some value"`}))
+	})
+
+	It("has only the columns for an empty result", func() {
+		job, err := jobs.Submit("someone", "SELECT id, timestamp FROM payloads WHERE timestamp > 1000", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(finished(job.ID).Status).To(Equal(services.JobSucceeded))
+
+		calls := [][]any{}
+		err = jobs.Results(job.ID, func(columns []string, values []any) error {
+			Expect(columns).To(Equal([]string{"id", "timestamp"}))
+
+			calls = append(calls, values)
+
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls).To(Equal([][]any{nil}))
+	})
+
+	It("records the error of a failed query", func() {
+		job, err := jobs.Submit("someone", "SELECT * FROM missing", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+
+		job = finished(job.ID)
+		Expect(job.Status).To(Equal(services.JobFailed))
+		Expect(job.Error).To(ContainSubstring("no such table"))
+
+		err = jobs.Results(job.ID, func([]string, []any) error { return nil })
+		Expect(err).To(MatchError(services.ErrJobNotFinished))
+	})
+
+	It("refuses more than one statement", func() {
+		_, err := jobs.Submit("someone", "SELECT 1; SELECT 2", services.TimeRange{})
+		Expect(err).To(MatchError(services.ErrMultipleStatements))
+	})
+
+	It("cancels a running job", func() {
+		job, err := jobs.Submit(
+			"someone",
+			"WITH RECURSIVE forever(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM forever) SELECT COUNT(*) FROM forever",
+			services.TimeRange{},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(jobs.Delete(job.ID)).To(Succeed())
+		Expect(finished(job.ID).Status).To(Equal(services.JobCancelled))
+	})
+
+	It("refuses jobs over the maximum running", func() {
+		job, err := jobs.Submit(
+			"someone",
+			"WITH RECURSIVE forever(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM forever) SELECT COUNT(*) FROM forever",
+			services.TimeRange{},
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = jobs.Submit("someone", "SELECT 1", services.TimeRange{})
+		Expect(err).To(MatchError(services.ErrTooManyJobs))
+
+		Expect(jobs.Delete(job.ID)).To(Succeed())
+		finished(job.ID)
+
+		_, err = jobs.Submit("someone", "SELECT 1", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("removes expired results without new jobs", func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		reader := services.NewReader(services.NewPersistence("file://"+remotePath, zap.NewNop()), os.TempDir(), zap.NewNop())
+
+		expiring, err := services.NewJobs(reader, filepath.Join(resultPath, "expiring"), 50*time.Millisecond, 0, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		defer expiring.Close()
+
+		job, err := expiring.Submit("someone", "SELECT 1", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			_, err := expiring.Get(job.ID)
+
+			return err
+		}).Should(MatchError(services.ErrJobNotFound))
+		Expect(filepath.Join(resultPath, "expiring", job.ID+".db")).NotTo(BeAnExistingFile())
+	})
+
+	It("keeps results without a time to live", func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		reader := services.NewReader(services.NewPersistence("file://"+remotePath, zap.NewNop()), os.TempDir(), zap.NewNop())
+
+		keeping, err := services.NewJobs(reader, filepath.Join(resultPath, "keeping"), 0, 0, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		defer keeping.Close()
+
+		job, err := keeping.Submit("someone", "SELECT 1", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() (services.JobStatus, error) {
+			job, err := keeping.Get(job.ID)
+
+			return job.Status, err
+		}).Should(Equal(services.JobSucceeded))
+
+		keeping.Sweep()
+
+		_, err = keeping.Get(job.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(resultPath, "keeping", job.ID+".db")).To(BeARegularFile())
+	})
+
+	It("removes a finished job and its results", func() {
+		job, err := jobs.Submit("someone", "SELECT 1", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		finished(job.ID)
+
+		Expect(filepath.Join(resultPath, job.ID+".db")).To(BeARegularFile())
+		Expect(jobs.Delete(job.ID)).To(Succeed())
+		Expect(filepath.Join(resultPath, job.ID+".db")).NotTo(BeAnExistingFile())
+
+		_, err = jobs.Get(job.ID)
+		Expect(err).To(MatchError(services.ErrJobNotFound))
+		Expect(jobs.Delete(job.ID)).To(MatchError(services.ErrJobNotFound))
+	})
+})
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrLabelSelector is returned for a selector that cannot be parsed.
+var ErrLabelSelector = errors.New("invalid label selector")
+
+// maxCachedSelectors bounds the parsed selectors kept for labels_match.
+const maxCachedSelectors = 1000
+
+// LabelMatcher is one comparison of a label selector, like Prometheus'.
+type LabelMatcher struct {
+	Name     string
+	Operator string
+	Value    string
+	regexp   *regexp.Regexp
+}
+
+// Matches compares the label, where a missing label is the empty string.
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+
+	switch m.Operator {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.regexp.MatchString(value)
+	default:
+		return !m.regexp.MatchString(value)
+	}
+}
+
+// LabelSelector is every matcher of a selector like `{name="value", other=~"re.*"}`.
+type LabelSelector []LabelMatcher
+
+// Matches is true when every matcher matches the labels.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, matcher := range s {
+		if !matcher.Matches(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals are the labels the selector requires to have a value, to prune with bloom filters.
+func (s LabelSelector) Equals() map[string]string {
+	labels := map[string]string{}
+
+	for _, matcher := range s {
+		if matcher.Operator == "=" && matcher.Value != "" {
+			labels[matcher.Name] = matcher.Value
+		}
+	}
+
+	return labels
+}
+
+var (
+	labelName     = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+	labelOperator = regexp.MustCompile(`^(=~|!~|!=|=)`)
+)
+
+// ParseLabelSelector parses a Prometheus selector of label matchers, with
+// or without braces. Values are quoted with double quotes, single quotes or
+// backticks, and regular expressions match the whole value.
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	rest := strings.TrimSpace(selector)
+	if strings.HasPrefix(rest, "{") {
+		if !strings.HasSuffix(rest, "}") {
+			return nil, fmt.Errorf("%w: %q is missing a closing brace", ErrLabelSelector, selector)
+		}
+
+		rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	}
+
+	matchers := LabelSelector{}
+
+	for rest != "" {
+		name := labelName.FindString(rest)
+		if name == "" {
+			return nil, fmt.Errorf("%w: expected a label name at %q", ErrLabelSelector, rest)
+		}
+
+		rest = strings.TrimSpace(rest[len(name):])
+
+		operator := labelOperator.FindString(rest)
+		if operator == "" {
+			return nil, fmt.Errorf("%w: expected =, !=, =~ or !~ after %q", ErrLabelSelector, name)
+		}
+
+		rest = strings.TrimSpace(rest[len(operator):])
+
+		value, remaining, err := unquoteLabel(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		matcher := LabelMatcher{Name: name, Operator: operator, Value: value}
+
+		if strings.HasSuffix(operator, "~") {
+			matcher.regexp, err = regexp.Compile("^(?:" + value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrLabelSelector, err)
+			}
+		}
+
+		matchers = append(matchers, matcher)
+
+		rest = strings.TrimSpace(remaining)
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if rest != "" {
+			return nil, fmt.Errorf("%w: expected a comma at %q", ErrLabelSelector, rest)
+		}
+	}
+
+	return matchers, nil
+}
+
+// unquoteLabel returns the quoted value at the start of text, and the text after it.
+func unquoteLabel(text string) (string, string, error) {
+	if text == "" {
+		return "", "", fmt.Errorf("%w: expected a quoted value", ErrLabelSelector)
+	}
+
+	quote := text[0]
+
+	switch quote {
+	case '`':
+		end := strings.IndexByte(text[1:], '`')
+		if end < 0 {
+			return "", "", fmt.Errorf("%w: %q is missing a closing quote", ErrLabelSelector, text)
+		}
+
+		return text[1 : end+1], text[end+2:], nil
+	case '"', '\'':
+	default:
+		return "", "", fmt.Errorf("%w: expected a quoted value at %q", ErrLabelSelector, text)
+	}
+
+	var value strings.Builder
+
+	for rest := text[1:]; rest != ""; {
+		if rest[0] == quote {
+			return value.String(), rest[1:], nil
+		}
+
+		char, _, tail, err := strconv.UnquoteChar(rest, quote)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %q is not a valid value", ErrLabelSelector, text)
+		}
+
+		value.WriteRune(char)
+
+		rest = tail
+	}
+
+	return "", "", fmt.Errorf("%w: %q is missing a closing quote", ErrLabelSelector, text)
+}
+
+// selectors caches the parsed selectors of labels_match, as it is called for each row.
+var selectors = struct {
+	sync.Mutex
+	parsed map[string]LabelSelector
+}{parsed: map[string]LabelSelector{}}
+
+func cachedSelector(selector string) (LabelSelector, error) {
+	selectors.Lock()
+	defer selectors.Unlock()
+
+	if parsed, ok := selectors.parsed[selector]; ok {
+		return parsed, nil
+	}
+
+	parsed, err := ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(selectors.parsed) >= maxCachedSelectors {
+		selectors.parsed = map[string]LabelSelector{}
+	}
+
+	selectors.parsed[selector] = parsed
+
+	return parsed, nil
+}
+
+func payloadLabels(payload any) (map[string]string, bool) {
+	var text string
+
+	switch payload := payload.(type) {
+	case string:
+		text = payload
+	case []byte:
+		text = string(payload)
+	default:
+		return nil, false
+	}
+
+	event := struct {
+		Labels map[string]string `json:"labels"`
+	}{}
+
+	err := json.Unmarshal([]byte(text), &event)
+	if err != nil {
+		return nil, false
+	}
+
+	return event.Labels, true
+}
+
+// label returns the value of a label of the payload, or NULL without it.
+func label(args []any) (any, error) {
+	labels, ok := payloadLabels(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	name, _ := args[1].(string)
+
+	value, ok := labels[name]
+	if !ok {
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+// labelsMatch is 1 when the payload's labels match the selector.
+func labelsMatch(args []any) (any, error) {
+	selector, ok := args[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: labels_match selector must be text", ErrFunctionArguments)
+	}
+
+	parsed, err := cachedSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, ok := payloadLabels(args[0])
+	if !ok {
+		return nil, nil
+	}
+
+	if parsed.Matches(labels) {
+		return int64(1), nil
+	}
+
+	return int64(0), nil
+}
@@ -0,0 +1,51 @@
+package services_test
+
+import (
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Label selectors", func() {
+	labels := map[string]string{"product_name": "Terraform", "order_id": "111"}
+
+	DescribeTable("matching labels",
+		func(selector string, expected bool) {
+			parsed, err := services.ParseLabelSelector(selector)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.Matches(labels)).To(Equal(expected))
+		},
+		Entry("equal", `{product_name="Terraform"}`, true),
+		Entry("not equal", `{order_id!="1"}`, true),
+		Entry("regular expression", `{product_name=~"Terra.*", order_id!="1"}`, true),
+		Entry("anchored regular expression", `{product_name=~"Terra"}`, false),
+		Entry("negated regular expression", `{product_name!~"Terra.*"}`, false),
+		Entry("missing label as empty", `{region=""}`, true),
+		Entry("missing label not equal", `{region!="us"}`, true),
+		Entry("without braces", `order_id="111"`, true),
+		Entry("single quotes", `{product_name='Terraform',}`, true),
+		Entry("backticks", "{product_name=~`Terra\\w+`}", true),
+		Entry("escaped quotes", `{product_name!="Terra\"form"}`, true),
+		Entry("every matcher", `{product_name="Terraform", order_id="1"}`, false),
+		Entry("nothing", `{}`, true),
+	)
+
+	It("has the labels that must equal a value", func() {
+		parsed, err := services.ParseLabelSelector(`{a="1", b=~"2", c="", d!="4"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.Equals()).To(Equal(map[string]string{"a": "1"}))
+	})
+
+	DescribeTable("refusing invalid selectors",
+		func(selector string) {
+			_, err := services.ParseLabelSelector(selector)
+			Expect(err).To(MatchError(services.ErrLabelSelector))
+		},
+		Entry("missing brace", `{a="1"`),
+		Entry("missing operator", `{a "1"}`),
+		Entry("unquoted value", `{a=1}`),
+		Entry("missing quote", `{a="1}`),
+		Entry("missing comma", `{a="1" b="2"}`),
+		Entry("invalid regular expression", `{a=~"("}`),
+	)
+})
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// InstanceID identifies this process in the metadata of the files it writes.
+//
+//nolint: gochecknoglobals
+var InstanceID = uuid.Must(uuid.NewV7()).String()
+
+func softwareVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	return info.Main.Version
+}
+
+// writeMetadata records what is needed to understand a file without the server:
+// the range and size of its contents, and where and how it was written.
+func writeMetadata(db *sql.DB, createdAt time.Time) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO metadata (key, value)
+		SELECT 'min_timestamp', COALESCE(MIN(payload->>'$.time'), '') FROM payloads
+		UNION ALL
+		SELECT 'max_timestamp', COALESCE(MAX(payload->>'$.time'), '') FROM payloads
+		UNION ALL
+		SELECT 'count', COUNT(*) FROM payloads
+		UNION ALL
+		SELECT 'label_keys', json_group_array(key) FROM (
+			SELECT DISTINCT labels.key AS key
+			FROM payloads, json_each(payloads.payload, '$.labels') AS labels
+			WHERE labels.key IS NOT NULL
+			ORDER BY labels.key
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("could not record contents metadata: %w", err)
+	}
+
+	bloom, err := labelBloom(db)
+	if err != nil {
+		return err
+	}
+
+	values := [][2]string{
+		{"label_bloom", bloom},
+		{"hostname", hostname},
+		{"instance_id", InstanceID},
+		{"software_version", softwareVersion()},
+		{"driver", dbDriverKind},
+		{"created_at", createdAt.UTC().Format(time.RFC3339Nano)},
+		{"closed_at", time.Now().UTC().Format(time.RFC3339Nano)},
+	}
+
+	for _, value := range values {
+		_, err = db.Exec(`INSERT INTO metadata (key, value) VALUES (?, ?);`, value[0], value[1])
+		if err != nil {
+			return fmt.Errorf("could not record %s metadata: %w", value[0], err)
+		}
+	}
+
+	return nil
+}
+
+// labelBloom is a bloom filter of every label's key and value, so a file can be
+// skipped by queries for labels it does not have, without downloading it.
+func labelBloom(db *sql.DB) (string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT labels.key, CAST(labels.value AS TEXT)
+		FROM payloads, json_each(payloads.payload, '$.labels') AS labels
+		WHERE labels.key IS NOT NULL;
+	`)
+	if err != nil {
+		return "", fmt.Errorf("could not query labels: %w", err)
+	}
+	defer rows.Close()
+
+	pairs := []string{}
+
+	for rows.Next() {
+		var key, value string
+
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return "", fmt.Errorf("could not scan label: %w", err)
+		}
+
+		pairs = append(pairs, labelPair(key, value))
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return "", fmt.Errorf("could not read labels: %w", err)
+	}
+
+	bloom := newBloomFilter(len(pairs))
+	for _, pair := range pairs {
+		bloom.add(pair)
+	}
+
+	return bloom.encode(), nil
+}
+
+// ReadMetadata returns the metadata table of a local database file.
+// When a key has been recorded more than once, the latest value wins.
+func ReadMetadata(filename string) (map[string]string, error) {
+	db, err := openReadOnly(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT key, value FROM metadata ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("could not query metadata %q: %w", filename, err)
+	}
+	defer rows.Close()
+
+	metadata := map[string]string{}
+
+	for rows.Next() {
+		var key, value string
+
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan metadata: %w", err)
+		}
+
+		metadata[key] = value
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("could not read metadata: %w", err)
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "tsdb"
+
+var (
+	eventsInserted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_inserted_total",
+		Help:      "Events accepted into the in-memory buffer.",
+	})
+	eventsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_rejected_total",
+		Help:      "Events refused because the in-memory buffer was full.",
+	})
+	eventsWritten = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_written_total",
+		Help:      "Events written to the active database.",
+	})
+	eventsWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_write_errors_total",
+		Help:      "Events that could not be written to the active database.",
+	})
+	bufferDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_depth",
+		Help:      "Events waiting in the in-memory buffer.",
+	})
+	bufferCapacity = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_capacity",
+		Help:      "Events the in-memory buffer holds before dropping the oldest.",
+	})
+	bufferDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "buffer_dropped_total",
+		Help:      "Events dropped from a full in-memory buffer.",
+	})
+	rotations = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rotations_total",
+		Help:      "Times the active database was replaced with a new one.",
+	})
+	writerRows = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "writer_rows",
+		Help:      "Events in the active database.",
+	})
+	finalizeQueue = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "finalize_queue_length",
+		Help:      "Databases waiting to be closed and uploaded.",
+	})
+	uploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upload_duration_seconds",
+		Help:      "Time to upload a database to the remote location.",
+		Buckets:   prometheus.DefBuckets,
+	})
+	uploadBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes uploaded to the remote location.",
+	})
+	uploadFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upload_failures_total",
+		Help:      "Uploads to the remote location that failed.",
+	})
+	queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_duration_seconds",
+		Help:      "Time to run a query, by outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10), //nolint: gomnd
+	}, []string{"outcome"})
+	queryFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_files_total",
+		Help:      "Files read by queries.",
+	})
+	queryFilesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_files_skipped_total",
+		Help:      "Files pruned from queries by time range or label bloom filter.",
+	})
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_hits_total",
+		Help:      "Files read by queries from the local cache.",
+	})
+	cacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_misses_total",
+		Help:      "Files downloaded into the local cache.",
+	})
+	cacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_evictions_total",
+		Help:      "Files removed from the local cache to stay under its size.",
+	})
+	cacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "cache_bytes",
+		Help:      "Size of the files in the local cache.",
+	})
+	queryJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_jobs_total",
+		Help:      "Background query jobs finished, by status.",
+	}, []string{"status"})
+	queryJobsRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "query_jobs_running",
+		Help:      "Background query jobs running.",
+	})
+)
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type migration struct {
+	// version is recorded in the metadata table once the migration is applied.
+	version int
+	// up moves a writable database to this version. Queries copy the payloads
+	// of older files into a database at the latest version, so files are never
+	// migrated after they are persisted.
+	up string
+}
+
+//nolint: gochecknoglobals
+var migrations = []migration{
+	{
+		version: 1,
+		up: `
+			CREATE TABLE IF NOT EXISTS payloads (
+				id         INTEGER PRIMARY KEY,
+				payload    TEXT NOT NULL,
+				timestamp  INT GENERATED ALWAYS AS (payload->'$.timestamp') VIRTUAL,
+				value      TEXT GENERATED ALWAYS AS (payload->'$.value') VIRTUAL
+			);
+			CREATE TABLE IF NOT EXISTS metadata (
+				id    INTEGER PRIMARY KEY,
+				key   TEXT NOT NULL,
+				value TEXT NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS payloads_timestamp ON payloads(timestamp);
+			CREATE VIRTUAL TABLE IF NOT EXISTS events USING fts5(value, content=payloads, content_rowid=id);
+			CREATE TRIGGER IF NOT EXISTS payload_insert AFTER INSERT ON payloads BEGIN
+				INSERT INTO events(rowid, value) VALUES (new.id, new.value);
+			END;
+		`,
+	},
+	{
+		// events are sent with a "time" field, "timestamp" was always NULL
+		version: 2,
+		up: `
+			DROP INDEX payloads_timestamp;
+			ALTER TABLE payloads DROP COLUMN timestamp;
+			ALTER TABLE payloads ADD COLUMN timestamp INT GENERATED ALWAYS AS (payload->>'$.time') VIRTUAL;
+			CREATE INDEX payloads_timestamp ON payloads(timestamp);
+		`,
+	},
+	{
+		// labels can be matched in the sqlite3 shell, without the query functions
+		version: 3,
+		up: `
+			CREATE VIEW event_labels AS
+				SELECT payloads.id AS id, labels.key AS key, labels.value AS value
+				FROM payloads, json_each(payloads.payload, '$.labels') AS labels;
+		`,
+	},
+	{
+		// the events without their JSON layout, for the sqlite3 shell
+		version: 4,
+		up: `
+			CREATE VIEW events_view AS
+				SELECT
+					id,
+					timestamp AS ts,
+					strftime('%Y-%m-%dT%H:%M:%fZ', timestamp / 1000000000.0, 'unixepoch') AS time_iso,
+					payload->>'$.value' AS value,
+					payload->'$.labels' AS labels_json
+				FROM payloads;
+		`,
+	},
+}
+
+// SchemaVersion is the version of newly written database files.
+//
+//nolint: gochecknoglobals
+var SchemaVersion = migrations[len(migrations)-1].version
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// schemaVersion returns the version recorded in a database, 0 for an empty one.
+func schemaVersion(db querier) (int, error) {
+	var exists int
+
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'metadata';`).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("could not check for metadata: %w", err)
+	}
+
+	if exists == 0 {
+		return 0, nil
+	}
+
+	var version int
+
+	err = db.QueryRow(`SELECT COALESCE(MAX(CAST(value AS INT)), 0) FROM metadata WHERE key = 'version';`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("could not read version: %w", err)
+	}
+
+	return version, nil
+}
+
+// migrate applies, each in its own transaction, the migrations newer than the database's version.
+func migrate(db *sql.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= version {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("could not begin migration %d: %w", migration.version, err)
+		}
+
+		_, err = tx.Exec(migration.up)
+		if err != nil {
+			_ = tx.Rollback()
+
+			return fmt.Errorf("could not apply migration %d: %w", migration.version, err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO metadata (key, value) VALUES ('version', ?);`, migration.version)
+		if err != nil {
+			_ = tx.Rollback()
+
+			return fmt.Errorf("could not record migration %d: %w", migration.version, err)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return fmt.Errorf("could not commit migration %d: %w", migration.version, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Migrations", func() {
+	var (
+		persistence *services.Persistence
+		reader      *services.Reader
+		workPath    string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		workPath, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, workPath)
+
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		persistence = services.NewPersistence("file://"+remotePath, zap.NewNop())
+		reader = services.NewReader(persistence, workPath, zap.NewNop())
+	})
+
+	It("writes files at the current schema version", func() {
+		persistFile(persistence, "1.db", 100)
+
+		files, err := reader.Files(services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files[0].SchemaVersion).To(Equal(services.SchemaVersion))
+	})
+
+	It("can reopen an existing file", func() {
+		filename := filepath.Join(workPath, "1.db")
+
+		writer, err := services.NewWriter(filename, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+
+		writer, err = services.NewWriter(filename, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Insert(&sdk.Event{Time: 1})).To(Succeed())
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	It("presents older files with the current schema", func() {
+		filename := filepath.Join(workPath, "1.db")
+
+		db, err := sql.Open(services.DBDriverName, filename)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = db.Exec(`
+			CREATE TABLE payloads (
+				id         INTEGER PRIMARY KEY,
+				payload    TEXT NOT NULL,
+				timestamp  INT GENERATED ALWAYS AS (payload->'$.timestamp') VIRTUAL,
+				value      TEXT GENERATED ALWAYS AS (payload->'$.value') VIRTUAL
+			);
+			CREATE TABLE metadata (
+				id    INTEGER PRIMARY KEY,
+				key   TEXT NOT NULL,
+				value TEXT NOT NULL
+			);
+			INSERT INTO metadata(key, value) VALUES ('version', '1');
+			INSERT INTO payloads(payload) VALUES ('{"time":100,"value":"a"}'), ('{"time":200,"value":"b"}');
+		`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(db.Close()).To(Succeed())
+
+		err = persistence.Upload(filename)
+		Expect(err).NotTo(HaveOccurred())
+
+		timestamps := []any{}
+		err = reader.Query(context.Background(), "SELECT timestamp FROM payloads ORDER BY id", services.TimeRange{}, func(_ []string, values []any) error {
+			timestamps = append(timestamps, values[0])
+
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timestamps).To(Equal([]any{int64(100), int64(200)}))
+	})
+})
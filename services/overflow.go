@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OverflowPolicy decides what happens to an event inserted into a full buffer.
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest makes room by dropping the oldest buffered event.
+	// Producers are never slowed down, at the cost of losing data.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowReject refuses the event, so the producer can retry later.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowBlock waits for room, up to a timeout, before refusing the event.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+var (
+	ErrBufferFull    = errors.New("buffer is full")
+	ErrBufferTimeout = errors.New("timed out waiting for room in the buffer")
+)
+
+// Overflow configures how a Switcher handles a full buffer.
+type Overflow struct {
+	Policy OverflowPolicy
+	// Timeout is how long OverflowBlock waits for room.
+	Timeout time.Duration
+}
+
+func (o Overflow) validate() error {
+	switch o.Policy {
+	case OverflowDropOldest, OverflowReject:
+		return nil
+	case OverflowBlock:
+		if o.Timeout <= 0 {
+			return fmt.Errorf("overflow policy %q requires a timeout", o.Policy)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown overflow policy %q", o.Policy)
+	}
+}
@@ -2,15 +2,37 @@ package services
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/c2fo/vfs/v6/vfssimple"
 	"go.uber.org/zap"
 )
 
 type Persistence struct {
+	lastUpload int64
+	// manifests are the catalog entries already read, by file name
+	manifests      map[string]manifest
+	manifestsMutex sync.Mutex
+	// foldMutex has one fold of the catalog index at a time
+	foldMutex            sync.Mutex
+	persisted            uint64
 	remoteLocationPrefix string
 	logger               *zap.Logger
+	uploadErrors         uint64
+}
+
+// PersistenceStats summarizes the uploads done by a Persistence.
+type PersistenceStats struct {
+	// Persisted is the number of events in the uploaded files.
+	Persisted    uint64
+	LastUpload   time.Time
+	UploadErrors uint64
 }
 
 func NewPersistence(
@@ -19,15 +41,71 @@ func NewPersistence(
 ) *Persistence {
 	return &Persistence{
 		logger:               logger,
+		manifests:            map[string]manifest{},
 		remoteLocationPrefix: remoteLocationPrefix,
 	}
 }
 
+// databaseFilename matches the files of a writer, named by when they were
+// created, and of a compaction, named by the range of their events.
+var databaseFilename = regexp.MustCompile(`^\d+(-\d+)?\.db$`)
+
 func (p *Persistence) Finalize(filename string) {
+	err := p.Upload(filename)
+	if err != nil {
+		p.logger.Error("could not finalize", zap.String("local", filename), zap.Error(err))
+	}
+}
+
+// Upload copies a local database file to the remote location, using the base name as the key,
+// and records it in the catalog.
+func (p *Persistence) Upload(filename string) error {
+	return p.UploadReplacing(filename, nil)
+}
+
+// UploadReplacing uploads a file compacted from others, swapping them for it
+// in the catalog with the single write of its manifest. The replaced files
+// are left for the caller to delete, and are never read again if that fails.
+func (p *Persistence) UploadReplacing(filename string, replaces []string) error {
+	start := time.Now()
+
+	err := p.upload(filename, replaces)
+	if err != nil {
+		atomic.AddUint64(&p.uploadErrors, 1)
+		uploadFailures.Inc()
+
+		return err
+	}
+
+	atomic.StoreInt64(&p.lastUpload, time.Now().UnixNano())
+	uploadDuration.Observe(time.Since(start).Seconds())
+
+	return nil
+}
+
+func (p *Persistence) Stats() PersistenceStats {
+	stats := PersistenceStats{
+		Persisted:    atomic.LoadUint64(&p.persisted),
+		UploadErrors: atomic.LoadUint64(&p.uploadErrors),
+	}
+
+	if lastUpload := atomic.LoadInt64(&p.lastUpload); lastUpload > 0 {
+		stats.LastUpload = time.Unix(0, lastUpload).UTC()
+	}
+
+	return stats
+}
+
+func (p *Persistence) upload(filename string, replaces []string) error {
 	logger := p.logger
 
+	info, err := Inspect(filename)
+	if err != nil {
+		return fmt.Errorf("could not inspect: %w", err)
+	}
+
 	localLocation := fmt.Sprintf("file://%s", filename)
-	s3Location := fmt.Sprintf("%s/%s", p.remoteLocationPrefix, filepath.Base(filename))
+	s3Location := p.remoteURI(filepath.Base(filename))
 
 	logger = logger.With(
 		zap.String("remote", s3Location),
@@ -38,22 +116,120 @@ func (p *Persistence) Finalize(filename string) {
 
 	s3File, err := vfssimple.NewFile(s3Location)
 	if err != nil {
-		logger.Error("could not reference remote", zap.Error(err))
-
-		return
+		return fmt.Errorf("could not reference remote: %w", err)
 	}
 
 	localFile, err := vfssimple.NewFile(localLocation)
 	if err != nil {
-		logger.Error("could not reference local", zap.Error(err))
-
-		return
+		return fmt.Errorf("could not reference local: %w", err)
 	}
 
 	err = localFile.CopyToFile(s3File)
 	if err != nil {
-		logger.Error("could not copy", zap.Error(err))
+		return fmt.Errorf("could not copy: %w", err)
+	}
+
+	uploadBytes.Add(float64(info.Size))
+	atomic.AddUint64(&p.persisted, uint64(info.Count))
 
-		return
+	err = p.writeManifest(manifest{FileInfo: *info, Replaces: replaces})
+	if err != nil {
+		return fmt.Errorf("could not add to catalog: %w", err)
+	}
+
+	_, err = p.foldCatalog()
+	if err != nil {
+		return fmt.Errorf("could not add to catalog: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the names of the database files in the remote location, oldest first.
+func (p *Persistence) List() ([]string, error) {
+	location, err := vfssimple.NewLocation(p.remoteURI(""))
+	if err != nil {
+		return nil, fmt.Errorf("could not reference remote location: %w", err)
+	}
+
+	names, err := location.ListByRegex(databaseFilename)
+	if err != nil {
+		return nil, fmt.Errorf("could not list remote location: %w", err)
 	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Download copies a remote database file to a local path.
+func (p *Persistence) Download(name string, filename string) error {
+	s3File, err := vfssimple.NewFile(p.remoteURI(name))
+	if err != nil {
+		return fmt.Errorf("could not reference remote: %w", err)
+	}
+
+	localFile, err := vfssimple.NewFile(fmt.Sprintf("file://%s", filename))
+	if err != nil {
+		return fmt.Errorf("could not reference local: %w", err)
+	}
+
+	err = s3File.CopyToFile(localFile)
+	if err != nil {
+		return fmt.Errorf("could not copy %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete removes a database file from the catalog, then the remote location,
+// so a query never plans to read a deleted file.
+func (p *Persistence) Delete(name string) error {
+	err := p.deleteManifest(name)
+	if err != nil {
+		return fmt.Errorf("could not remove from catalog: %w", err)
+	}
+
+	_, err = p.foldCatalog()
+	if err != nil {
+		return fmt.Errorf("could not remove from catalog: %w", err)
+	}
+
+	s3File, err := vfssimple.NewFile(p.remoteURI(name))
+	if err != nil {
+		return fmt.Errorf("could not reference remote: %w", err)
+	}
+
+	err = s3File.Delete()
+	if err != nil {
+		return fmt.Errorf("could not delete %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func (p *Persistence) inspectRemote(name string, workPath string) (*FileInfo, error) {
+	dir, err := os.MkdirTemp(workPath, "inspect-")
+	if err != nil {
+		return nil, fmt.Errorf("could not create download directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, name)
+
+	err = p.Download(name, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := Inspect(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not inspect: %w", err)
+	}
+
+	return info, nil
+}
+
+func (p *Persistence) remoteURI(name string) string {
+	return fmt.Sprintf("%s/%s", p.remoteLocationPrefix, name)
 }
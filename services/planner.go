@@ -0,0 +1,272 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Plan is the files a query needs to read, after pruning the catalog.
+type Plan struct {
+	Files []FileInfo
+	// Local are the filenames of databases not yet persisted, read after Files.
+	Local []string
+	// Skipped is the number of files in the catalog that were pruned.
+	Skipped int
+	// TimeRange is the request's range, the only filter of the events a query sees.
+	TimeRange TimeRange
+	// FileRange is the request's range narrowed by the query's timestamp
+	// predicates, only used to prune files.
+	FileRange TimeRange
+	// Labels are the label values the query requires, only used to prune with bloom filters.
+	Labels map[string]string
+}
+
+var (
+	// predicates are only trusted in a single SELECT with no OR or NOT,
+	// where every constraint must hold for a row to match
+	unsafePredicates = regexp.MustCompile(`(?i)\b(OR|NOT)\b`)
+	selects          = regexp.MustCompile(`(?i)\bSELECT\b`)
+	whereClause      = regexp.MustCompile(`(?is)\bWHERE\b(.*?)(?:\b(?:GROUP|ORDER|LIMIT|WINDOW)\b|$)`)
+
+	timestampCompare  = regexp.MustCompile(`(?i)\btimestamp\s*(>=|<=|>|<|=)\s*(-?\d+)\b`)
+	compareTimestamp  = regexp.MustCompile(`(?i)\b(-?\d+)\s*(>=|<=|>|<|=)\s*timestamp\b`)
+	timestampBetween  = regexp.MustCompile(`(?i)\btimestamp\s+BETWEEN\s+(-?\d+)\s+AND\s+(-?\d+)\b`)
+	labelEquals       = regexp.MustCompile(`(?i)payload\s*->>\s*'\$\.labels\.(\w+)'\s*=\s*'((?:[^']|'')*)'`)
+	labelExtractEqual = regexp.MustCompile(`(?i)json_extract\(\s*payload\s*,\s*'\$\.labels\.(\w+)'\s*\)\s*=\s*'((?:[^']|'')*)'`)
+	labelFuncEqual    = regexp.MustCompile(`(?i)\blabel\(\s*payload\s*,\s*'(\w+)'\s*\)\s*=\s*'((?:[^']|'')*)'`)
+	// labels_match is only a predicate on its own, not compared with a value
+	labelsMatchCall = regexp.MustCompile(`(?i)\blabels_match\(\s*payload\s*,\s*'((?:[^']|'')*)'\s*\)\s*([=<>!]|IS\b)?`)
+
+	// a predicate is one of the conditions that must all hold only when it
+	// is preceded and followed by AND, parentheses or nothing, so
+	// `timestamp < 200 + 200` or `CASE WHEN timestamp > 250 THEN` are not read
+	precedingAnd = regexp.MustCompile(`(?i)(^|\bAND)[\s(]*$`)
+	followingAnd = regexp.MustCompile(`(?i)^[\s);]*($|AND\b)`)
+)
+
+// NewPlan prunes the catalog to the files that can have rows for the query.
+// Files are skipped when outside the time range, narrowed by the query's
+// `timestamp` comparisons, or when their bloom filter shows they do not have
+// a label the query requires with `payload->>'$.labels.name' = 'value'`,
+// `label(payload, 'name') = 'value'` or an equality in `labels_match`.
+// Predicates are only read from the WHERE clause of a query with a single
+// SELECT and no OR or NOT, and only when they stand alone between ANDs,
+// parentheses or the ends of the clause, otherwise only the request's time
+// range is used. The text of strings, quoted names and comments is never
+// read as part of the query.
+// As predicates are found by matching text, they only skip whole files, and
+// the query still filters the rows of the files read.
+func NewPlan(query string, timeRange TimeRange, catalog *Catalog) Plan {
+	plan := Plan{
+		Files:     []FileInfo{},
+		Local:     []string{},
+		TimeRange: timeRange,
+		FileRange: timeRange,
+		Labels:    map[string]string{},
+	}
+
+	masked := maskQuery(query)
+
+	if !unsafePredicates.MatchString(masked.text) && len(selects.FindAllString(masked.text, -1)) <= 1 {
+		if where := whereClause.FindStringSubmatchIndex(masked.text); where != nil {
+			clause := masked.slice(where[2], where[3])
+			plan.FileRange = narrowTimeRange(clause, timeRange)
+			plan.Labels = queryLabels(clause)
+		}
+	}
+
+	for _, file := range catalog.Filter(plan.FileRange) {
+		if file.mayHaveLabels(plan.Labels) {
+			plan.Files = append(plan.Files, file)
+		}
+	}
+
+	plan.Skipped = len(catalog.Files) - len(plan.Files)
+
+	return plan
+}
+
+func narrowTimeRange(query maskedQuery, timeRange TimeRange) TimeRange {
+	after := func(nanos int64) {
+		if start := time.Unix(0, nanos).UTC(); timeRange.Start.IsZero() || start.After(timeRange.Start) {
+			timeRange.Start = start
+		}
+	}
+	before := func(nanos int64) {
+		if end := time.Unix(0, nanos).UTC(); timeRange.End.IsZero() || end.Before(timeRange.End) {
+			timeRange.End = end
+		}
+	}
+	compare := func(operator string, nanos int64) {
+		switch operator {
+		case ">":
+			after(nanos + 1)
+		case ">=":
+			after(nanos)
+		case "<":
+			before(nanos - 1)
+		case "<=":
+			before(nanos)
+		case "=":
+			after(nanos)
+			before(nanos)
+		}
+	}
+	flipped := map[string]string{">": "<", ">=": "<=", "<": ">", "<=": ">=", "=": "="}
+
+	for _, match := range matches(timestampCompare, query) {
+		if nanos, err := strconv.ParseInt(match[2], 10, 64); err == nil {
+			compare(match[1], nanos)
+		}
+	}
+
+	for _, match := range matches(compareTimestamp, query) {
+		if nanos, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			compare(flipped[match[2]], nanos)
+		}
+	}
+
+	for _, match := range matches(timestampBetween, query) {
+		start, startErr := strconv.ParseInt(match[1], 10, 64)
+		end, endErr := strconv.ParseInt(match[2], 10, 64)
+
+		if startErr == nil && endErr == nil {
+			after(start)
+			before(end)
+		}
+	}
+
+	return timeRange
+}
+
+func queryLabels(query maskedQuery) map[string]string {
+	labels := map[string]string{}
+
+	for _, pattern := range []*regexp.Regexp{labelEquals, labelExtractEqual, labelFuncEqual} {
+		for _, match := range matches(pattern, query) {
+			labels[match[1]] = strings.ReplaceAll(match[2], "''", "'")
+		}
+	}
+
+	for _, match := range matches(labelsMatchCall, query) {
+		if match[2] != "" {
+			continue
+		}
+
+		selector, err := ParseLabelSelector(strings.ReplaceAll(match[1], "''", "'"))
+		if err != nil {
+			continue
+		}
+
+		for name, value := range selector.Equals() {
+			labels[name] = value
+		}
+	}
+
+	return labels
+}
+
+// maskedQuery is a query with the text of its strings, quoted names and
+// comments blanked out, so only the query itself is matched against.
+type maskedQuery struct {
+	original string
+	text     string
+	// inside is true for each byte of the text that was blanked out
+	inside []bool
+}
+
+func maskQuery(query string) maskedQuery {
+	masked := maskedQuery{original: query, inside: make([]bool, len(query))}
+	text := []byte(query)
+
+	for _, token := range tokenize(query) {
+		start, end := token.start, token.end
+
+		switch token.kind {
+		case tokenString, tokenQuoted:
+			terminator := query[start]
+			if terminator == '[' {
+				terminator = ']'
+			}
+
+			// the quotes are kept, so a string is still where it was
+			start++
+			if end > start && query[end-1] == terminator {
+				end--
+			}
+		case tokenComment:
+		default:
+			continue
+		}
+
+		for index := start; index < end; index++ {
+			text[index] = ' '
+			masked.inside[index] = true
+		}
+	}
+
+	masked.text = string(text)
+
+	return masked
+}
+
+func (m maskedQuery) slice(start, end int) maskedQuery {
+	return maskedQuery{original: m.original[start:end], text: m.text[start:end], inside: m.inside[start:end]}
+}
+
+// matches are the submatches of the pattern that are predicates on their
+// own, not part of a larger expression or a column of another table.
+// A predicate must start and end outside of strings and comments, and the
+// text around it is read without them.
+func matches(pattern *regexp.Regexp, clause maskedQuery) [][]string {
+	found := [][]string{}
+
+	for _, loc := range pattern.FindAllStringSubmatchIndex(clause.original, -1) {
+		start, end := loc[0], loc[1]
+
+		if clause.inside[start] || clause.inside[end-1] {
+			continue
+		}
+
+		if start > 0 && clause.original[start-1] == '.' {
+			continue
+		}
+
+		if !precedingAnd.MatchString(clause.text[:start]) || !followingAnd.MatchString(clause.text[end:]) {
+			continue
+		}
+
+		match := make([]string, len(loc)/2) //nolint: gomnd
+		for index := range match {
+			if loc[2*index] >= 0 {
+				match[index] = clause.original[loc[2*index]:loc[2*index+1]]
+			}
+		}
+
+		found = append(found, match)
+	}
+
+	return found
+}
+
+// mayHaveLabels is false only when the file's bloom filter rules out one of the labels.
+func (f FileInfo) mayHaveLabels(labels map[string]string) bool {
+	if len(labels) == 0 || f.LabelBloom == "" {
+		return true
+	}
+
+	bloom, err := decodeBloomFilter(f.LabelBloom)
+	if err != nil {
+		return true
+	}
+
+	for key, value := range labels {
+		if !bloom.has(labelPair(key, value)) {
+			return false
+		}
+	}
+
+	return true
+}
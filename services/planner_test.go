@@ -0,0 +1,141 @@
+package services_test
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Planner", func() {
+	var (
+		catalog *services.Catalog
+		reader  *services.Reader
+	)
+
+	BeforeEach(func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		persistence := services.NewPersistence("file://"+remotePath, zap.NewNop())
+		reader = services.NewReader(persistence, os.TempDir(), zap.NewNop())
+
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300, 400, 500)
+		persistFile(persistence, "3.db", 600)
+
+		catalog, err = persistence.Catalog()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	names := func(plan services.Plan) []string {
+		names := []string{}
+		for _, file := range plan.Files {
+			names = append(names, file.Name)
+		}
+
+		return names
+	}
+
+	It("scans every file without constraints", func() {
+		plan := services.NewPlan("SELECT * FROM payloads", services.TimeRange{}, catalog)
+		Expect(names(plan)).To(Equal([]string{"1.db", "2.db", "3.db"}))
+		Expect(plan.Skipped).To(Equal(0))
+	})
+
+	It("prunes by the request's time range", func() {
+		plan := services.NewPlan("SELECT * FROM payloads", services.TimeRange{End: time.Unix(0, 250)}, catalog)
+		Expect(names(plan)).To(Equal([]string{"1.db"}))
+		Expect(plan.Skipped).To(Equal(2))
+	})
+
+	DescribeTable("narrowing the time range with timestamp predicates",
+		func(query string, expected ...string) {
+			Expect(names(services.NewPlan(query, services.TimeRange{}, catalog))).To(Equal(expected))
+		},
+		Entry("greater than", "SELECT * FROM payloads WHERE timestamp > 500", "3.db"),
+		Entry("at least", "SELECT * FROM payloads WHERE timestamp >= 500", "2.db", "3.db"),
+		Entry("less than", "SELECT * FROM payloads WHERE timestamp < 300", "1.db"),
+		Entry("reversed", "SELECT * FROM payloads WHERE 300 > timestamp", "1.db"),
+		Entry("equal", "SELECT * FROM payloads WHERE timestamp = 400", "2.db"),
+		Entry("between", "SELECT * FROM payloads WHERE timestamp BETWEEN 150 AND 350", "1.db", "2.db"),
+		Entry("with other conditions", "SELECT * FROM payloads WHERE value = 'x' AND timestamp > 550", "3.db"),
+		Entry("not with OR", "SELECT * FROM payloads WHERE timestamp > 550 OR id = 1", "1.db", "2.db", "3.db"),
+		Entry("not outside the WHERE clause", "SELECT timestamp > 550 FROM payloads", "1.db", "2.db", "3.db"),
+		Entry("not after the WHERE clause", "SELECT * FROM payloads WHERE value = 'x' GROUP BY timestamp > 550", "1.db", "2.db", "3.db"),
+		Entry("not with subqueries", "SELECT * FROM (SELECT * FROM payloads) WHERE timestamp > 550", "1.db", "2.db", "3.db"),
+		Entry("in parentheses", "SELECT * FROM payloads WHERE (timestamp > 550) AND value = 'x'", "3.db"),
+		Entry("not in arithmetic", "SELECT * FROM payloads WHERE timestamp < 200 + 200", "1.db", "2.db", "3.db"),
+		Entry("not in reversed arithmetic", "SELECT * FROM payloads WHERE 200 + 200 > timestamp", "1.db", "2.db", "3.db"),
+		Entry("not in a CASE", "SELECT * FROM payloads WHERE CASE WHEN timestamp > 250 THEN 0 ELSE 1 END = 1", "1.db", "2.db", "3.db"),
+		Entry("not compared again", "SELECT * FROM payloads WHERE (timestamp > 550) = 0", "1.db", "2.db", "3.db"),
+		Entry("not of another table", "SELECT * FROM payloads a JOIN payloads b WHERE a.timestamp > 550", "1.db", "2.db", "3.db"),
+		Entry("not in a string", "SELECT * FROM payloads WHERE value = ' AND timestamp > 550 AND '", "1.db", "2.db", "3.db"),
+		Entry("not in a comment", "SELECT * FROM payloads WHERE value = 1 /* AND timestamp > 550 */", "1.db", "2.db", "3.db"),
+		Entry("not in a line comment", "SELECT * FROM payloads WHERE value = 1\n-- AND timestamp > 550\n", "1.db", "2.db", "3.db"),
+		Entry("with OR in a string", "SELECT * FROM payloads WHERE value = 'this OR that' AND timestamp > 550", "3.db"),
+		Entry("with WHERE in a string", "SELECT * FROM payloads WHERE value = ' WHERE ' AND timestamp > 550", "3.db"),
+	)
+
+	It("narrows, never widens, the request's time range", func() {
+		plan := services.NewPlan(
+			"SELECT * FROM payloads WHERE timestamp > 150",
+			services.TimeRange{End: time.Unix(0, 350)},
+			catalog,
+		)
+		Expect(names(plan)).To(Equal([]string{"1.db", "2.db"}))
+		Expect(plan.FileRange.Start).To(Equal(time.Unix(0, 151).UTC()))
+		Expect(plan.FileRange.End).To(Equal(time.Unix(0, 350)))
+		Expect(plan.TimeRange).To(Equal(services.TimeRange{End: time.Unix(0, 350)}))
+	})
+
+	It("prunes files with label bloom filters", func() {
+		plan := services.NewPlan("SELECT * FROM payloads WHERE payload->>'$.labels.index' = '400'", services.TimeRange{}, catalog)
+		Expect(plan.Labels).To(Equal(map[string]string{"index": "400"}))
+		Expect(names(plan)).To(Equal([]string{"2.db"}))
+		Expect(plan.Skipped).To(Equal(2))
+
+		plan = services.NewPlan("SELECT * FROM payloads WHERE json_extract(payload, '$.labels.index') = '600'", services.TimeRange{}, catalog)
+		Expect(names(plan)).To(Equal([]string{"3.db"}))
+	})
+
+	DescribeTable("prunes files with the label functions",
+		func(query string, expected ...string) {
+			Expect(names(services.NewPlan(query, services.TimeRange{}, catalog))).To(Equal(expected))
+		},
+		Entry("label", "SELECT * FROM payloads WHERE label(payload, 'index') = '400'", "2.db"),
+		Entry("labels_match", `SELECT * FROM payloads WHERE labels_match(payload, '{index="600", other=~"a.*"}')`, "3.db"),
+		Entry("labels_match with only regular expressions", `SELECT * FROM payloads WHERE labels_match(payload, '{index=~"6.*"}')`, "1.db", "2.db", "3.db"),
+		Entry("label in an expression", "SELECT * FROM payloads WHERE label(payload, 'index') = '400' = 0", "1.db", "2.db", "3.db"),
+		Entry("label in a string", "SELECT * FROM payloads WHERE value = ' AND label(payload, ''index'') = ''400'' AND '", "1.db", "2.db", "3.db"),
+		Entry("labels_match compared with a value", `SELECT * FROM payloads WHERE labels_match(payload, '{index="600"}') = 0`, "1.db", "2.db", "3.db"),
+	)
+
+	It("scans files without a bloom filter", func() {
+		catalog.Files[0].LabelBloom = ""
+
+		plan := services.NewPlan("SELECT * FROM payloads WHERE payload->>'$.labels.index' = '400'", services.TimeRange{}, catalog)
+		Expect(names(plan)).To(Equal([]string{"1.db", "2.db"}))
+	})
+
+	It("plans from the catalog when querying", func() {
+		plan, err := reader.Plan("SELECT * FROM payloads WHERE timestamp >= 300", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Skipped).To(Equal(1))
+
+		count := 0
+		err = reader.Execute(context.Background(), plan, "SELECT * FROM payloads WHERE timestamp >= 300", func([]string, []any) error {
+			count++
+
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(4))
+	})
+})
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrQueryLimit is returned when a query would go past one of its QueryLimits.
+var ErrQueryLimit = errors.New("query limit exceeded")
+
+const defaultQueryConcurrency = 4
+
+// QueryLimits bounds the work done by a query. A zero limit is unlimited.
+type QueryLimits struct {
+	// Timeout stops the query, interrupting sqlite, once it has run this long.
+	Timeout time.Duration
+	// MaxRows is the number of result rows returned.
+	MaxRows int64
+	// MaxBytes is the size of the result values returned, strings by length and others as 8 bytes.
+	MaxBytes int64
+	// MaxFiles is the number of files a query can read.
+	MaxFiles int
+	// MaxLoadBytes is the size of the payloads loaded from the files into the
+	// in-memory database the query runs against.
+	MaxLoadBytes int64
+	// Concurrency is the number of files downloaded at once, defaulting to 4.
+	Concurrency int
+}
+
+func (l QueryLimits) checkFiles(plan Plan) error {
+	files := len(plan.Files) + len(plan.Local)
+	if l.MaxFiles > 0 && files > l.MaxFiles {
+		return fmt.Errorf("%w: query reads %d files, the limit is %d", ErrQueryLimit, files, l.MaxFiles)
+	}
+
+	return nil
+}
+
+// countRows stops the rows once they are over MaxRows or MaxBytes.
+func (l QueryLimits) countRows(fn RowFunc) RowFunc {
+	var rows, size int64
+
+	return func(columns []string, values []any) error {
+		if values == nil {
+			return fn(columns, values)
+		}
+
+		rows++
+		if l.MaxRows > 0 && rows > l.MaxRows {
+			return fmt.Errorf("%w: more than %d rows", ErrQueryLimit, l.MaxRows)
+		}
+
+		for _, value := range values {
+			size += valueSize(value)
+		}
+
+		if l.MaxBytes > 0 && size > l.MaxBytes {
+			return fmt.Errorf("%w: more than %d bytes", ErrQueryLimit, l.MaxBytes)
+		}
+
+		return fn(columns, values)
+	}
+}
+
+func valueSize(value any) int64 {
+	switch value := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(value))
+	case []byte:
+		return int64(len(value))
+	default:
+		return 8 //nolint: gomnd
+	}
+}
+
+// downloaded is a file ready to be read, release is called once it has been.
+type downloaded struct {
+	filename string
+	release  func() error
+	err      error
+}
+
+// download fetches the files into dir, or the cache, Concurrency at a time.
+// The result of each file is sent on its channel, so they can be read in the
+// plan's order. The returned func waits for the downloads to stop, after ctx
+// is done, and releases those that were not read.
+func (r *Reader) download(ctx context.Context, dir string, files []FileInfo) ([]chan downloaded, func()) {
+	concurrency := r.limits.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultQueryConcurrency
+	}
+
+	indexes := make(chan int, len(files))
+	results := make([]chan downloaded, len(files))
+
+	for index := range files {
+		indexes <- index
+		results[index] = make(chan downloaded, 1)
+	}
+
+	close(indexes)
+
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < concurrency && worker < len(files); worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for index := range indexes {
+				if ctx.Err() != nil {
+					results[index] <- downloaded{err: ctx.Err()}
+
+					continue
+				}
+
+				results[index] <- r.fetch(files[index], dir)
+			}
+		}()
+	}
+
+	return results, func() {
+		wg.Wait()
+
+		for _, result := range results {
+			select {
+			case unread := <-result:
+				if unread.err == nil {
+					_ = unread.release()
+				}
+			default:
+			}
+		}
+	}
+}
+
+func (r *Reader) fetch(file FileInfo, dir string) downloaded {
+	fetch := func(filename string) error {
+		r.logger.Info("downloading file", zap.String("name", file.Name))
+
+		err := r.persistence.Download(file.Name, filename)
+		if err != nil {
+			return fmt.Errorf("could not download: %w", err)
+		}
+
+		return nil
+	}
+
+	// without a checksum a replaced file could not be told apart
+	if r.cache != nil && file.Checksum != "" {
+		filename, release, err := r.cache.Get(file.Name, file.Checksum, fetch)
+		if err != nil {
+			return downloaded{err: err}
+		}
+
+		return downloaded{filename: filename, release: func() error {
+			release()
+
+			return nil
+		}}
+	}
+
+	filename := filepath.Join(dir, file.Name)
+
+	err := fetch(filename)
+	if err != nil {
+		return downloaded{err: err}
+	}
+
+	return downloaded{filename: filename, release: func() error {
+		err := os.Remove(filename)
+		if err != nil {
+			return fmt.Errorf("could not remove download: %w", err)
+		}
+
+		return nil
+	}}
+}
@@ -0,0 +1,456 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RowFunc receives each row of a query result. A result without rows calls it
+// once with nil values, so its columns are still known.
+type RowFunc func(columns []string, values []any) error
+
+// Progress is told how many of a query's files have been read, as it runs.
+type Progress func(done, total int)
+
+type progressKey struct{}
+
+// WithProgress has queries run with the context report their progress.
+func WithProgress(ctx context.Context, progress Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+func reportProgress(ctx context.Context, done, total int) {
+	if progress, ok := ctx.Value(progressKey{}).(Progress); ok {
+		progress(done, total)
+	}
+}
+
+// LocalSource has the database files written locally that may not be persisted yet.
+type LocalSource interface {
+	LocalFiles() []string
+	// ReadLocal calls fn when the file is safe to read.
+	ReadLocal(filename string, fn func() error) error
+}
+
+// Reader runs queries against the persisted database files.
+type Reader struct {
+	cache       *FileCache
+	limits      QueryLimits
+	local       LocalSource
+	logger      *zap.Logger
+	persistence *Persistence
+	workPath    string
+}
+
+func NewReader(
+	persistence *Persistence,
+	workPath string,
+	logger *zap.Logger,
+) *Reader {
+	return &Reader{
+		logger:      logger,
+		persistence: persistence,
+		workPath:    workPath,
+	}
+}
+
+// Files returns the persisted files with events in the time range, from the catalog.
+func (r *Reader) Files(timeRange TimeRange) ([]FileInfo, error) {
+	catalog, err := r.persistence.Catalog()
+	if err != nil {
+		return nil, fmt.Errorf("could not read catalog: %w", err)
+	}
+
+	return catalog.Filter(timeRange), nil
+}
+
+// IncludeLocal has queries also read the local files that are not yet in the catalog.
+func (r *Reader) IncludeLocal(local LocalSource) {
+	r.local = local
+}
+
+// UseCache keeps the downloaded files in the cache, to be read by later queries.
+func (r *Reader) UseCache(cache *FileCache) {
+	r.cache = cache
+}
+
+// SetLimits bounds the work done by each query.
+func (r *Reader) SetLimits(limits QueryLimits) {
+	r.limits = limits
+}
+
+// Plan prunes the catalog to the files the query needs, see NewPlan.
+// The local files are listed before reading the catalog, so a file uploaded
+// in between is read once from the remote location rather than not at all.
+func (r *Reader) Plan(query string, timeRange TimeRange) (Plan, error) {
+	local := []string{}
+	if r.local != nil {
+		local = r.local.LocalFiles()
+	}
+
+	catalog, err := r.persistence.Catalog()
+	if err != nil {
+		return Plan{}, fmt.Errorf("could not read catalog: %w", err)
+	}
+
+	plan := NewPlan(query, timeRange, catalog)
+	queryFilesSkipped.Add(float64(plan.Skipped))
+
+	cataloged := map[string]bool{}
+	for _, file := range catalog.Files {
+		cataloged[file.Name] = true
+	}
+
+	for _, filename := range local {
+		if !cataloged[filepath.Base(filename)] {
+			plan.Local = append(plan.Local, filename)
+		}
+	}
+
+	return plan, nil
+}
+
+// Query plans then executes the SQL.
+func (r *Reader) Query(ctx context.Context, query string, timeRange TimeRange, fn RowFunc) error {
+	plan, err := r.Plan(query, timeRange)
+	if err != nil {
+		return err
+	}
+
+	return r.Execute(ctx, plan, query, fn)
+}
+
+// Execute runs the SQL over the events of every file in the plan, persisted
+// then local, as if they were one database, in two phases.
+// First a partial query, of the events in the request's time range, is pushed
+// down to each file, and its rows are loaded into an in-memory database at
+// the current schema. Then the SQL is run once against that database, so
+// GROUP BY, ORDER BY, LIMIT and aggregates apply across files.
+// The query stops, interrupting sqlite, when ctx is done or a limit is reached.
+func (r *Reader) Execute(ctx context.Context, plan Plan, query string, fn RowFunc) error {
+	start := time.Now()
+
+	err := singleStatement(query)
+	if err != nil {
+		return err
+	}
+
+	err = r.limits.checkFiles(plan)
+	if err != nil {
+		return err
+	}
+
+	if r.limits.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, r.limits.Timeout)
+		defer cancel()
+	}
+
+	err = r.execute(ctx, plan, query, r.limits.countRows(fn))
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("query stopped: %w", ctx.Err())
+	}
+
+	queryDuration.WithLabelValues(outcome(err)).Observe(time.Since(start).Seconds())
+
+	return err
+}
+
+func (r *Reader) execute(ctx context.Context, plan Plan, query string, fn RowFunc) error {
+	dir, err := os.MkdirTemp(r.workPath, "query-")
+	if err != nil {
+		return fmt.Errorf("could not create download directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open(dbDriverName, ":memory:")
+	if err != nil {
+		return fmt.Errorf("could not open combined database: %w", err)
+	}
+	defer db.Close()
+
+	// the in-memory database, the authorizer and query_only are on the one connection
+	db.SetMaxOpenConns(1)
+
+	fullText := fullTextSearch.MatchString(query)
+
+	err = combinedSchema(db, fullText)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get connection: %w", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	downloads, wait := r.download(ctx, dir, plan.Files)
+
+	// the downloads stop before their directory is removed
+	defer wait()
+	defer cancel()
+
+	total := len(plan.Files) + len(plan.Local)
+	reportProgress(ctx, 0, total)
+
+	load := &partialLoad{conn: conn, timeRange: plan.TimeRange, maxBytes: r.limits.MaxLoadBytes}
+
+	for index, file := range plan.Files {
+		var download downloaded
+
+		select {
+		case download = <-downloads[index]:
+		case <-ctx.Done():
+			download.err = ctx.Err()
+		}
+
+		if download.err != nil {
+			return download.err
+		}
+
+		r.logger.Info("querying file", zap.String("name", file.Name))
+
+		queryFiles.Inc()
+
+		err = load.file(ctx, file.Name, readOnlyURI(download.filename))
+		if err != nil {
+			_ = download.release()
+
+			return err
+		}
+
+		err = download.release()
+		if err != nil {
+			return err
+		}
+
+		reportProgress(ctx, index+1, total)
+	}
+
+	for index, filename := range plan.Local {
+		r.logger.Info("querying local file", zap.String("filename", filename))
+
+		queryFiles.Inc()
+
+		// in WAL mode the active database is read as of the start of the partial query
+		err = r.local.ReadLocal(filename, func() error {
+			return load.file(ctx, filepath.Base(filename), readOnlyURI(filename))
+		})
+		if err != nil {
+			return err
+		}
+
+		reportProgress(ctx, len(plan.Files)+index+1, total)
+	}
+
+	if fullText {
+		_, err = conn.ExecContext(ctx, `INSERT INTO events(events) VALUES ('rebuild');`)
+		if err != nil {
+			return fmt.Errorf("could not index combined events: %w", err)
+		}
+	}
+
+	denied, err := readOnly(ctx, conn, query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err == nil {
+		defer rows.Close()
+
+		err = scanRows(rows, fn)
+	} else {
+		err = fmt.Errorf("could not query: %w", err)
+	}
+
+	if reason := denied(); err != nil && reason != "" {
+		return fmt.Errorf("%w: %s", ErrNotAllowed, reason)
+	}
+
+	return asFunctionError(err)
+}
+
+// fullTextSearch is a query reading the events table, which the combined
+// database only has when it is needed.
+var fullTextSearch = regexp.MustCompile(`(?i)\bevents\b`)
+
+// combinedSchema migrates the in-memory database to the current schema.
+// Its events are indexed for full text search once they are all loaded,
+// rather than by the trigger as each is inserted, and only when the query
+// reads the events table.
+func combinedSchema(db *sql.DB, fullText bool) error {
+	err := migrate(db)
+	if err != nil {
+		return fmt.Errorf("could not create combined database: %w", err)
+	}
+
+	statements := `DROP TRIGGER payload_insert;`
+	if !fullText {
+		statements += `DROP TABLE events;`
+	}
+
+	_, err = db.Exec(statements)
+	if err != nil {
+		return fmt.Errorf("could not create combined database: %w", err)
+	}
+
+	return nil
+}
+
+func readOnlyURI(filename string) string {
+	return (&url.URL{Scheme: "file", Path: filename, RawQuery: "mode=ro"}).String()
+}
+
+// partialLoad loads the rows of the partial query of each file into the combined database.
+type partialLoad struct {
+	conn      *sql.Conn
+	timeRange TimeRange
+	maxBytes  int64
+	bytes     int64
+}
+
+// partialQuery is pushed down to each file, selecting the payloads in the
+// request's time range. The time is read from the payload, as the timestamp
+// column differs between schema versions.
+func (l *partialLoad) partialQuery() (string, []any) {
+	conditions := []string{"1 = 1"}
+	args := []any{}
+
+	if !l.timeRange.Start.IsZero() {
+		conditions = append(conditions, `payload->>'$.time' >= ?`)
+		args = append(args, l.timeRange.Start.UnixNano())
+	}
+
+	if !l.timeRange.End.IsZero() {
+		conditions = append(conditions, `payload->>'$.time' <= ?`)
+		args = append(args, l.timeRange.End.UnixNano())
+	}
+
+	return fmt.Sprintf(
+		`SELECT payload FROM payloads WHERE %s ORDER BY id;`,
+		strings.Join(conditions, " AND "),
+	), args
+}
+
+// file runs the partial query against a file, opened read-only, and inserts
+// its rows into the combined database, stopping once more than maxBytes of
+// payloads have been loaded across the files.
+func (l *partialLoad) file(ctx context.Context, name string, source string) error {
+	db, err := sql.Open(dbDriverName, source)
+	if err != nil {
+		return fmt.Errorf("could not open %q: %w", name, err)
+	}
+	defer db.Close()
+
+	query, args := l.partialQuery()
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("could not query %q: %w", name, err)
+	}
+	defer rows.Close()
+
+	tx, err := l.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin loading %q: %w", name, err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	insert, err := tx.PrepareContext(ctx, `INSERT INTO payloads (payload) VALUES (?);`)
+	if err != nil {
+		return fmt.Errorf("could not prepare loading %q: %w", name, err)
+	}
+	defer insert.Close()
+
+	for rows.Next() {
+		var payload string
+
+		err = rows.Scan(&payload)
+		if err != nil {
+			return fmt.Errorf("could not read payload from %q: %w", name, err)
+		}
+
+		l.bytes += int64(len(payload))
+		if l.maxBytes > 0 && l.bytes > l.maxBytes {
+			return fmt.Errorf("%w: loads more than %d bytes of events", ErrQueryLimit, l.maxBytes)
+		}
+
+		_, err = insert.ExecContext(ctx, payload)
+		if err != nil {
+			return fmt.Errorf("could not load payload from %q: %w", name, err)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("could not read payloads from %q: %w", name, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("could not finish loading %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func scanRows(rows *sql.Rows, fn RowFunc) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("could not read columns: %w", err)
+	}
+
+	scanned := false
+
+	for rows.Next() {
+		scanned = true
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+
+		for index := range values {
+			pointers[index] = &values[index]
+		}
+
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return fmt.Errorf("could not scan row: %w", err)
+		}
+
+		for index, value := range values {
+			if bytes, ok := value.([]byte); ok {
+				values[index] = string(bytes)
+			}
+		}
+
+		err = fn(columns, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("could not read rows: %w", err)
+	}
+
+	if !scanned {
+		return fn(columns, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+func persistFile(persistence *services.Persistence, name string, times ...int64) {
+	workPath, err := os.MkdirTemp("", "")
+	Expect(err).NotTo(HaveOccurred())
+
+	defer os.RemoveAll(workPath)
+
+	writer, err := services.NewWriter(filepath.Join(workPath, name), zap.NewNop())
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, t := range times {
+		err = writer.Insert(&sdk.Event{
+			Time:   sdk.Time(t),
+			Labels: sdk.Labels{"index": fmt.Sprint(t)},
+			Value:  "some value",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	err = writer.Close()
+	Expect(err).NotTo(HaveOccurred())
+
+	err = persistence.Upload(writer.Filename())
+	Expect(err).NotTo(HaveOccurred())
+}
+
+var _ = Describe("Reader", func() {
+	var (
+		persistence *services.Persistence
+		reader      *services.Reader
+		remotePath  string
+	)
+
+	BeforeEach(func() {
+		var err error
+
+		remotePath, err = os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		persistence = services.NewPersistence("file://"+remotePath, zap.NewNop())
+		reader = services.NewReader(persistence, os.TempDir(), zap.NewNop())
+
+		persistFile(persistence, "1.db", 100, 200)
+		persistFile(persistence, "2.db", 300, 400, 500)
+	})
+
+	It("lists files with their time ranges", func() {
+		files, err := reader.Files(services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+
+		Expect(files[0].Name).To(Equal("1.db"))
+		Expect(files[0].Count).To(BeEquivalentTo(2))
+		Expect(files[0].MinTime).To(Equal(time.Unix(0, 100).UTC()))
+		Expect(files[0].MaxTime).To(Equal(time.Unix(0, 200).UTC()))
+		Expect(files[1].Count).To(BeEquivalentTo(3))
+	})
+
+	It("skips files outside the time range", func() {
+		files, err := reader.Files(services.TimeRange{
+			Start: time.Unix(0, 250),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].Name).To(Equal("2.db"))
+	})
+
+	It("combines every file before querying", func() {
+		results := []any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT COUNT(*) AS total FROM payloads",
+			services.TimeRange{},
+			func(columns []string, values []any) error {
+				Expect(columns).To(Equal([]string{"total"}))
+				results = append(results, values[0])
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]any{int64(5)}))
+	})
+
+	It("orders and limits across files", func() {
+		results := []any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT timestamp FROM payloads ORDER BY timestamp DESC LIMIT 3",
+			services.TimeRange{},
+			func(_ []string, values []any) error {
+				results = append(results, values[0])
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]any{int64(500), int64(400), int64(300)}))
+	})
+
+	It("groups across files", func() {
+		results := [][]any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT timestamp >= 200 AS late, COUNT(*) FROM payloads GROUP BY late ORDER BY late",
+			services.TimeRange{},
+			func(_ []string, values []any) error {
+				results = append(results, values)
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([][]any{{int64(0), int64(1)}, {int64(1), int64(4)}}))
+	})
+
+	It("only includes events in the time range", func() {
+		results := []any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT COUNT(*) FROM payloads",
+			services.TimeRange{Start: time.Unix(0, 200), End: time.Unix(0, 400)},
+			func(_ []string, values []any) error {
+				results = append(results, values[0])
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]any{int64(3)}))
+	})
+
+	It("filters rows with the SQL, not the predicates used to skip files", func() {
+		results := []any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT COUNT(*) FROM payloads WHERE timestamp < 200 + 200 AND timestamp > 100",
+			services.TimeRange{},
+			func(_ []string, values []any) error {
+				results = append(results, values[0])
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]any{int64(2)}))
+	})
+
+	It("searches the full text of the combined events", func() {
+		results := []any{}
+
+		err := reader.Query(
+			context.Background(),
+			"SELECT COUNT(*) FROM events WHERE events MATCH 'value'",
+			services.TimeRange{},
+			func(_ []string, values []any) error {
+				results = append(results, values[0])
+
+				return nil
+			},
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(Equal([]any{int64(5)}))
+	})
+
+	DescribeTable("matches labels",
+		func(query string, expected ...any) {
+			results := []any{}
+
+			err := reader.Query(context.Background(), query, services.TimeRange{}, func(_ []string, values []any) error {
+				results = append(results, values[0])
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(results).To(Equal(expected))
+		},
+		Entry("with label", "SELECT timestamp FROM payloads WHERE label(payload, 'index') = '300'", int64(300)),
+		Entry("with labels_match", `SELECT timestamp FROM payloads WHERE labels_match(payload, '{index=~"[45]00", index!="500"}')`, int64(400)),
+		Entry("with the labels view", "SELECT timestamp FROM payloads WHERE id IN (SELECT id FROM event_labels WHERE key = 'index' AND value GLOB '1*')", int64(100)),
+	)
+
+	It("reads the files from the cache on later queries", func() {
+		cachePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, cachePath)
+
+		cache, err := services.NewFileCache(cachePath, 1<<30, zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		reader.UseCache(cache)
+
+		count := func() any {
+			var total any
+
+			err := reader.Query(context.Background(), "SELECT COUNT(*) FROM payloads", services.TimeRange{}, func(_ []string, values []any) error {
+				total = values[0]
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			return total
+		}
+
+		Expect(count()).To(BeEquivalentTo(5))
+
+		entries, err := os.ReadDir(cachePath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+
+		// the cached copies are read once the remote ones are gone
+		Expect(os.Remove(filepath.Join(remotePath, "1.db"))).To(Succeed())
+		Expect(os.Remove(filepath.Join(remotePath, "2.db"))).To(Succeed())
+		Expect(count()).To(BeEquivalentTo(5))
+	})
+
+	It("includes the events not yet persisted", func() {
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, workPath)
+
+		release := make(chan struct{})
+		finalized := make(chan string, 1)
+
+		switcher, err := services.NewSwitcher(workPath, 2, 10, services.Overflow{}, services.FinalizerWrap(func(filename string) {
+			<-release
+			persistence.Finalize(filename)
+			finalized <- filename
+		}), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, t := range []int64{600, 700, 800} {
+			Expect(switcher.Insert(&sdk.Event{Time: sdk.Time(t), Value: "some value"})).To(Succeed())
+		}
+
+		Eventually(func() uint64 {
+			return switcher.Stats().Written
+		}).Should(BeEquivalentTo(3))
+
+		reader.IncludeLocal(switcher)
+
+		count := func() any {
+			var total any
+
+			err := reader.Query(context.Background(), "SELECT COUNT(*) FROM payloads", services.TimeRange{}, func(_ []string, values []any) error {
+				total = values[0]
+
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			return total
+		}
+
+		plan, err := reader.Plan("SELECT * FROM payloads", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Local).To(HaveLen(2))
+		Expect(count()).To(BeEquivalentTo(8))
+
+		close(release)
+		Eventually(finalized).Should(Receive())
+
+		plan, err = reader.Plan("SELECT * FROM payloads", services.TimeRange{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plan.Files).To(HaveLen(3))
+		Expect(plan.Local).To(HaveLen(1))
+		Expect(count()).To(BeEquivalentTo(8))
+
+		Expect(switcher.Close()).To(Succeed())
+	})
+
+	Describe("limits", func() {
+		noop := func([]string, []any) error {
+			return nil
+		}
+
+		It("stops after the maximum rows", func() {
+			reader.SetLimits(services.QueryLimits{MaxRows: 2})
+
+			err := reader.Query(context.Background(), "SELECT * FROM payloads", services.TimeRange{}, noop)
+			Expect(err).To(MatchError(services.ErrQueryLimit))
+			Expect(err).To(MatchError(ContainSubstring("more than 2 rows")))
+		})
+
+		It("stops after the maximum bytes", func() {
+			reader.SetLimits(services.QueryLimits{MaxBytes: 100})
+
+			err := reader.Query(context.Background(), "SELECT payload FROM payloads", services.TimeRange{}, noop)
+			Expect(err).To(MatchError(services.ErrQueryLimit))
+		})
+
+		It("stops after loading the maximum bytes of events", func() {
+			reader.SetLimits(services.QueryLimits{MaxLoadBytes: 100})
+
+			err := reader.Query(context.Background(), "SELECT COUNT(*) FROM payloads", services.TimeRange{}, noop)
+			Expect(err).To(MatchError(services.ErrQueryLimit))
+			Expect(err).To(MatchError(ContainSubstring("loads more than 100 bytes of events")))
+
+			err = reader.Query(context.Background(), "SELECT COUNT(*) FROM payloads", services.TimeRange{End: time.Unix(0, 100)}, noop)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("refuses to read more than the maximum files", func() {
+			reader.SetLimits(services.QueryLimits{MaxFiles: 1})
+
+			err := reader.Query(context.Background(), "SELECT * FROM payloads", services.TimeRange{}, noop)
+			Expect(err).To(MatchError(ContainSubstring("query reads 2 files, the limit is 1")))
+
+			err = reader.Query(context.Background(), "SELECT * FROM payloads", services.TimeRange{End: time.Unix(0, 250)}, noop)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("interrupts a query after the timeout", func() {
+			reader.SetLimits(services.QueryLimits{Timeout: 100 * time.Millisecond, Concurrency: 1})
+
+			err := reader.Query(
+				context.Background(),
+				"WITH RECURSIVE forever(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM forever) SELECT COUNT(*) FROM forever",
+				services.TimeRange{},
+				noop,
+			)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("stops when cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := reader.Query(ctx, "SELECT * FROM payloads", services.TimeRange{}, noop)
+			Expect(err).To(MatchError(context.Canceled))
+		})
+	})
+
+	It("returns an error for invalid SQL", func() {
+		err := reader.Query(context.Background(), "SELECT * FROM nothing", services.TimeRange{}, func([]string, []any) error {
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	DescribeTable("returns an error for invalid function arguments",
+		func(query string) {
+			err := reader.Query(context.Background(), query, services.TimeRange{}, func([]string, []any) error {
+				return nil
+			})
+			Expect(err).To(MatchError(services.ErrFunctionArguments))
+		},
+		Entry("a scalar", "SELECT time_bucket(timestamp, 'soon') FROM payloads"),
+		Entry("an aggregate", "SELECT percentile(value, 101) FROM payloads"),
+		Entry("a label selector", "SELECT labels_match(payload, '{index') FROM payloads"),
+	)
+})
+
+var _ = Describe("TimeRange", func() {
+	It("parses dates, RFC3339 and nanoseconds", func() {
+		timeRange, err := services.NewTimeRange("2022-01-01", "2022-12-31T10:00:00Z")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(timeRange.Start).To(Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(timeRange.End).To(Equal(time.Date(2022, 12, 31, 10, 0, 0, 0, time.UTC)))
+
+		parsed, err := services.ParseTime("1000")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(time.Unix(0, 1000).UTC()))
+
+		_, err = services.ParseTime("yesterday")
+		Expect(err).To(HaveOccurred())
+	})
+})
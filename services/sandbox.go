@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrMultipleStatements is returned for SQL with more than one statement.
+	ErrMultipleStatements = errors.New("only a single SQL statement can be run")
+	// ErrNotAllowed is returned for SQL that does more than read the events.
+	ErrNotAllowed = errors.New("only SELECT of the events is allowed")
+)
+
+// sqlite authorizer action codes, see https://www.sqlite.org/c3ref/c_alter_table.html
+const (
+	sqliteDelete    = 9
+	sqliteInsert    = 18
+	sqlitePragma    = 19
+	sqliteRead      = 20
+	sqliteSelect    = 21
+	sqliteUpdate    = 23
+	sqliteAttach    = 24
+	sqliteDetach    = 25
+	sqliteFunction  = 31
+	sqliteRecursive = 33
+)
+
+var actionNames = map[int]string{
+	sqliteDelete: "DELETE",
+	sqliteInsert: "INSERT",
+	sqlitePragma: "PRAGMA",
+	sqliteUpdate: "UPDATE",
+	sqliteAttach: "ATTACH",
+	sqliteDetach: "DETACH",
+}
+
+// allowedTables are the tables and views a query can read, including those FTS5 reads for the events table.
+var allowedTables = map[string]bool{
+	"payloads":        true,
+	"event_labels":    true,
+	"events_view":     true,
+	"events":          true,
+	"events_config":   true,
+	"events_data":     true,
+	"events_docsize":  true,
+	"events_idx":      true,
+	"json_each":       true,
+	"json_tree":       true,
+	"generate_series": true,
+}
+
+// allowedFunctions only compute values, leaving out those that load
+// extensions, inspect the connection, or allocate large blobs.
+var allowedFunctions = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		abs char coalesce concat concat_ws format glob hex ifnull iif instr
+		length like likelihood likely lower ltrim max min nullif octet_length
+		printf quote random replace round rtrim sign soundex substr substring
+		trim typeof unhex unicode unlikely upper
+		date time datetime julianday strftime timediff unixepoch
+		avg count group_concat string_agg sum total
+		row_number rank dense_rank percent_rank cume_dist ntile lag lead
+		first_value last_value nth_value
+		acos acosh asin asinh atan atan2 atanh ceil ceiling cos cosh degrees
+		exp floor ln log log10 log2 mod pi pow power radians sin sinh sqrt
+		tan tanh trunc
+		json json_array json_array_length json_extract -> ->> json_insert
+		json_object json_patch json_quote json_remove json_replace json_set
+		json_type json_valid json_group_array json_group_object
+		match bm25 highlight snippet
+	`) {
+		allowedFunctions[name] = true
+	}
+
+	for _, function := range scalarFunctions {
+		allowedFunctions[function.name] = true
+	}
+
+	for _, function := range aggregateFunctions {
+		allowedFunctions[function.name] = true
+	}
+}
+
+// authorize allows reading the events with SELECT and the allowed functions,
+// returning a description of anything else. The database is empty for the
+// common table expressions of the query.
+func authorize(action int, arg1, arg2, database string) string {
+	switch action {
+	case sqliteSelect, sqliteRecursive:
+		return ""
+	case sqliteRead:
+		if database == "" || allowedTables[strings.ToLower(arg1)] {
+			return ""
+		}
+
+		return fmt.Sprintf("reading table %q", arg1)
+	case sqliteFunction:
+		if allowedFunctions[strings.ToLower(arg2)] {
+			return ""
+		}
+
+		return fmt.Sprintf("function %q", arg2)
+	case sqlitePragma:
+		// FTS5 checks for changes to the database between queries
+		if arg1 == "data_version" && arg2 == "" {
+			return ""
+		}
+
+		return fmt.Sprintf("PRAGMA %s", arg1)
+	}
+
+	if name, ok := actionNames[action]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("sqlite action %d", action)
+}
+
+// readOnly restricts the connection to reading the events.
+// The returned func describes what was denied, when the query failed for that.
+func readOnly(ctx context.Context, conn *sql.Conn, query string) (func() string, error) {
+	_, err := conn.ExecContext(ctx, `PRAGMA query_only = ON;`)
+	if err != nil {
+		return nil, fmt.Errorf("could not make the connection read-only: %w", err)
+	}
+
+	return restrict(conn, query)
+}
+
+// singleStatement checks there is one statement, ignoring semicolons in
+// strings, quoted identifiers and comments.
+func singleStatement(query string) error {
+	statements := 0
+	pending := false
+
+	for index := 0; index < len(query); index++ {
+		char := query[index]
+
+		switch {
+		case strings.HasPrefix(query[index:], "--"):
+			index = skipTo(query, index+2, "\n")
+		case strings.HasPrefix(query[index:], "/*"):
+			index = skipTo(query, index+2, "*/")
+		case char == '\'' || char == '"' || char == '`':
+			index = skipTo(query, index+1, string(char))
+			pending = true
+		case char == '[':
+			index = skipTo(query, index+1, "]")
+			pending = true
+		case char == ';':
+			if pending {
+				statements++
+			}
+
+			pending = false
+		case !unicode.IsSpace(rune(char)):
+			pending = true
+		}
+	}
+
+	if pending {
+		statements++
+	}
+
+	if statements > 1 {
+		return ErrMultipleStatements
+	}
+
+	return nil
+}
+
+// skipTo returns the index of the last byte of the terminator after start, or of the query.
+// A doubled quote is read as the end of one string and the start of another.
+func skipTo(query string, start int, terminator string) int {
+	end := strings.Index(query[start:], terminator)
+	if end < 0 {
+		return len(query) - 1
+	}
+
+	return start + end + len(terminator) - 1
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenQuoted
+	tokenString
+	tokenNumber
+	tokenComment
+	tokenSymbol
+)
+
+// sqlToken is a word, quoted identifier, string, number, comment or symbol of
+// a query, from start to end. The text of a quoted identifier is unquoted.
+type sqlToken struct {
+	kind       tokenKind
+	text       string
+	start, end int
+}
+
+// tokenize splits a query into its tokens, reading a doubled quote as part of
+// a string or quoted identifier.
+func tokenize(query string) []sqlToken {
+	tokens := []sqlToken{}
+
+	for index := 0; index < len(query); {
+		char := query[index]
+		start := index
+
+		switch {
+		case unicode.IsSpace(rune(char)):
+			index++
+
+			continue
+		case strings.HasPrefix(query[index:], "--"):
+			index = skipTo(query, index+2, "\n") + 1
+			tokens = append(tokens, sqlToken{kind: tokenComment, start: start, end: index})
+		case strings.HasPrefix(query[index:], "/*"):
+			index = skipTo(query, index+2, "*/") + 1
+			tokens = append(tokens, sqlToken{kind: tokenComment, start: start, end: index})
+		case char == '\'' || char == '"' || char == '`' || char == '[':
+			terminator := char
+			if char == '[' {
+				terminator = ']'
+			}
+
+			index = skipQuoted(query, index+1, terminator)
+
+			kind := tokenQuoted
+			if char == '\'' {
+				kind = tokenString
+			}
+
+			// an unterminated string runs to the end of the query
+			text := query[start+1 : index]
+			if index > start+1 && query[index-1] == terminator {
+				text = query[start+1 : index-1]
+			}
+
+			tokens = append(tokens, sqlToken{
+				kind:  kind,
+				text:  strings.ReplaceAll(text, string([]byte{terminator, terminator}), string(terminator)),
+				start: start,
+				end:   index,
+			})
+		case isWordByte(char):
+			kind := tokenWord
+			if char >= '0' && char <= '9' {
+				kind = tokenNumber
+			}
+
+			for index < len(query) && (isWordByte(query[index]) || (kind == tokenNumber && query[index] == '.')) {
+				index++
+			}
+
+			tokens = append(tokens, sqlToken{kind: kind, text: query[start:index], start: start, end: index})
+		default:
+			index++
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: query[start:index], start: start, end: index})
+		}
+	}
+
+	return tokens
+}
+
+// skipQuoted returns the index after the terminator of a quoted string or
+// identifier starting at start, or the length of the query.
+func skipQuoted(query string, start int, terminator byte) int {
+	for index := start; index < len(query); index++ {
+		if query[index] != terminator {
+			continue
+		}
+
+		if terminator != ']' && index+1 < len(query) && query[index+1] == terminator {
+			index++
+
+			continue
+		}
+
+		return index + 1
+	}
+
+	return len(query)
+}
+
+func isWordByte(char byte) bool {
+	return char == '_' || char == '$' || char >= 0x80 ||
+		(char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9')
+}
+
+// statementStarts are the keywords a query to read the events can begin with.
+var statementStarts = map[string]bool{"SELECT": true, "WITH": true, "VALUES": true}
+
+// statementRefused are keywords that reach outside of the database or change the connection.
+var statementRefused = map[string]bool{"ATTACH": true, "DETACH": true, "PRAGMA": true}
+
+// parenthesisKeywords can be followed by a parenthesis without being a function call.
+var parenthesisKeywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`
+		ALL AND AS BETWEEN BY CASE CAST DISTINCT ELSE ESCAPE EXCEPT EXISTS
+		FILTER FROM GLOB HAVING IN INTERSECT IS JOIN LIKE LIMIT MATCH
+		MATERIALIZED NOT OFFSET ON OR OVER PARTITION RECURSIVE REGEXP SELECT
+		THEN UNION USING VALUES WHEN WHERE WINDOW WITH
+	`) {
+		parenthesisKeywords[keyword] = true
+	}
+}
+
+// allowStatement is the sandbox of a driver without an authorizer, for a
+// query against a connection that is already query_only, so it cannot write.
+// The query must start with SELECT, WITH or VALUES, must not ATTACH, DETACH
+// or PRAGMA, must not name the sqlite_ tables or the pragma_ functions, and
+// may only call the allowed functions and table-valued functions.
+func allowStatement(query string) error {
+	tokens := []sqlToken{}
+
+	for _, token := range tokenize(query) {
+		if token.kind != tokenComment {
+			tokens = append(tokens, token)
+		}
+	}
+
+	if len(tokens) == 0 || tokens[0].kind != tokenWord || !statementStarts[strings.ToUpper(tokens[0].text)] {
+		return fmt.Errorf("%w: only SELECT, WITH or VALUES can start a query", ErrNotAllowed)
+	}
+
+	for index, token := range tokens {
+		if token.kind != tokenWord && token.kind != tokenQuoted {
+			continue
+		}
+
+		name := strings.ToLower(token.text)
+		keyword := token.kind == tokenWord && parenthesisKeywords[strings.ToUpper(token.text)]
+
+		switch {
+		case token.kind == tokenWord && statementRefused[strings.ToUpper(token.text)]:
+			return fmt.Errorf("%w: %s", ErrNotAllowed, strings.ToUpper(token.text))
+		case strings.HasPrefix(name, "sqlite_") || strings.HasPrefix(name, "pragma_"):
+			return fmt.Errorf("%w: reading table %q", ErrNotAllowed, token.text)
+		case keyword || index+1 == len(tokens) || tokens[index+1].text != "(" || tokens[index+1].kind != tokenSymbol:
+			continue
+		case allowedFunctions[name] || allowedTables[name]:
+			continue
+		// the type of a CAST, such as VARCHAR(10)
+		case index > 0 && tokens[index-1].kind == tokenWord && strings.EqualFold(tokens[index-1].text, "AS"):
+			continue
+		// a common table expression with its columns, such as n(x) AS
+		case followedByAs(tokens, index+1):
+			continue
+		}
+
+		return fmt.Errorf("%w: function %q", ErrNotAllowed, token.text)
+	}
+
+	return nil
+}
+
+// followedByAs is whether the parenthesis at open is closed then followed by AS.
+func followedByAs(tokens []sqlToken, open int) bool {
+	depth := 0
+
+	for index := open; index < len(tokens); index++ {
+		if tokens[index].kind != tokenSymbol {
+			continue
+		}
+
+		switch tokens[index].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				next := index + 1
+
+				return next < len(tokens) && tokens[next].kind == tokenWord && strings.EqualFold(tokens[next].text, "AS")
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"context"
+	"os"
+
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Sandbox", func() {
+	var reader *services.Reader
+
+	BeforeEach(func() {
+		remotePath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, remotePath)
+
+		persistence := services.NewPersistence("file://"+remotePath, zap.NewNop())
+		reader = services.NewReader(persistence, os.TempDir(), zap.NewNop())
+
+		persistFile(persistence, "1.db", 100, 200)
+	})
+
+	query := func(sql string) error {
+		return reader.Query(context.Background(), sql, services.TimeRange{}, func([]string, []any) error {
+			return nil
+		})
+	}
+
+	DescribeTable("allows reading the events",
+		func(sql string) {
+			Expect(query(sql)).To(Succeed())
+		},
+		Entry("columns and functions", "SELECT id, timestamp, upper(value), payload->>'$.labels.index' FROM payloads"),
+		Entry("full text search", "SELECT snippet(events, 0, '[', ']', '', 5) FROM events WHERE events MATCH 'value'"),
+		Entry("table-valued JSON", "SELECT labels.key FROM payloads, json_each(payload, '$.labels') AS labels"),
+		Entry("label functions", `SELECT label(payload, 'index') FROM payloads WHERE labels_match(payload, '{index=~"1.*"}')`),
+		Entry("the views", "SELECT time_iso, labels_json FROM events_view JOIN event_labels USING (id)"),
+		Entry("time series functions", "SELECT time_bucket(timestamp, '1m'), rate(timestamp, value), median(value) FROM payloads GROUP BY 1"),
+		Entry("recursive CTEs", "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n LIMIT 3) SELECT x FROM n"),
+		Entry("window functions", "SELECT lag(timestamp) OVER (ORDER BY timestamp) FROM payloads"),
+		Entry("a trailing semicolon", "SELECT 1;"),
+		Entry("semicolons in strings and comments", "SELECT ';', \"a;b\" FROM (SELECT 1 AS \"a;b\") -- ;\n/* ; */"),
+	)
+
+	DescribeTable("refuses more than one statement",
+		func(sql string) {
+			Expect(query(sql)).To(MatchError(services.ErrMultipleStatements))
+		},
+		Entry("two selects", "SELECT 1; SELECT 2"),
+		Entry("a write after a select", "SELECT 1; DELETE FROM payloads"),
+		Entry("after a string with an escaped quote", "SELECT 'it''s;'; SELECT 2"),
+	)
+
+	DescribeTable("refuses anything but reading",
+		func(sql string) {
+			Expect(query(sql)).To(MatchError(services.ErrNotAllowed))
+		},
+		Entry("attach", "ATTACH DATABASE 'other.db' AS other"),
+		Entry("pragma", "PRAGMA query_only = OFF"),
+		Entry("delete", "DELETE FROM payloads"),
+		Entry("insert", "INSERT INTO payloads (payload) VALUES ('{}')"),
+	)
+
+	It("refuses writes hidden behind a CTE", func() {
+		Expect(query("WITH ids AS (SELECT 1) DELETE FROM payloads WHERE id IN ids")).To(HaveOccurred())
+	})
+
+	It("refuses loading extensions", func() {
+		Expect(query("SELECT load_extension('anything')")).To(HaveOccurred())
+	})
+
+	It("only allows approved functions", func() {
+		Expect(query("SELECT zeroblob(1000000000)")).To(MatchError(ContainSubstring(`function "zeroblob"`)))
+		Expect(query("SELECT * FROM pragma_table_info('payloads')")).To(MatchError(services.ErrNotAllowed))
+	})
+
+	When("the driver has an authorizer", func() {
+		BeforeEach(func() {
+			if services.DBDriverKind != "cgo" {
+				Skip("the pure Go driver has no authorizer")
+			}
+		})
+
+		It("only allows approved tables", func() {
+			Expect(query("SELECT * FROM metadata")).To(MatchError(ContainSubstring(`reading table "metadata"`)))
+		})
+
+		It("allows gap filling with generate_series", func() {
+			Expect(query("SELECT series.value, COUNT(id) FROM generate_series(0, 1000, 100) AS series LEFT JOIN payloads ON time_bucket(timestamp, 100) = series.value GROUP BY 1")).To(Succeed())
+		})
+	})
+
+	DescribeTable("allows statements that only read, for a driver without an authorizer",
+		func(sql string) {
+			Expect(services.AllowStatement(sql)).To(Succeed())
+		},
+		Entry("a common table expression with columns", "WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n LIMIT 3) SELECT x FROM n"),
+		Entry("a cast with a sized type", "SELECT CAST(value AS VARCHAR(10)) FROM payloads"),
+		Entry("a filtered aggregate and a window", "SELECT count(*) FILTER (WHERE id > 1), lag(id) OVER (PARTITION BY value) FROM payloads"),
+		Entry("table-valued JSON", "SELECT key FROM payloads, json_each(payload, '$.labels')"),
+		Entry("refused words in strings and comments", "SELECT 'zeroblob(1); PRAGMA' -- ATTACH\n/* sqlite_master */"),
+		Entry("values", "VALUES (1), (2)"),
+	)
+
+	DescribeTable("refuses statements, for a driver without an authorizer",
+		func(sql string) {
+			Expect(services.AllowStatement(sql)).To(MatchError(services.ErrNotAllowed))
+		},
+		Entry("pragma", "PRAGMA query_only = OFF"),
+		Entry("attach", "ATTACH DATABASE 'other.db' AS other"),
+		Entry("attach after a comment", "/* SELECT */ ATTACH DATABASE 'other.db' AS other"),
+		Entry("explain", "EXPLAIN SELECT 1"),
+		Entry("delete", "DELETE FROM payloads"),
+		Entry("a function", "SELECT load_extension('anything')"),
+		Entry("a quoted function", `SELECT "zeroblob"(1000000000)`),
+		Entry("a function with a comment before its arguments", "SELECT zeroblob /* */ (1000000000)"),
+		Entry("the schema table", "SELECT * FROM sqlite_master"),
+		Entry("a quoted pragma function", `SELECT * FROM "pragma_table_info"('payloads')`),
+		Entry("a table-valued pragma", "SELECT * FROM pragma_database_list"),
+	)
+})
@@ -0,0 +1,12 @@
+//go:build cgo && !sqlite_vtable
+// +build cgo,!sqlite_vtable
+
+package services
+
+import "github.com/mattn/go-sqlite3"
+
+// registerModules has nothing to add, as the driver is built without
+// virtual tables, so generate_series is not available.
+func registerModules(_ *sqlite3.SQLiteConn) error {
+	return nil
+}
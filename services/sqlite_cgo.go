@@ -4,7 +4,100 @@
 package services
 
 import (
-	_ "github.com/mattn/go-sqlite3"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	dbDriverName = "sqlite3_tsdb"
+	dbDriverKind = "cgo"
 )
 
-const dbDriverName = "sqlite3"
+func init() {
+	sql.Register(dbDriverName, &sqlite3.SQLiteDriver{ConnectHook: registerFunctions})
+}
+
+// registerFunctions adds the time series functions and modules to each connection.
+// The functions are variadic to the driver, so the arguments are counted here.
+func registerFunctions(conn *sqlite3.SQLiteConn) error {
+	for _, function := range scalarFunctions {
+		function := function
+
+		err := conn.RegisterFunc(function.name, func(args ...any) (any, error) {
+			err := checkArgs(function.name, function.args, args)
+			if err != nil {
+				return nil, err
+			}
+
+			return function.fn(args)
+		}, true)
+		if err != nil {
+			return fmt.Errorf("could not register %s: %w", function.name, err)
+		}
+	}
+
+	for _, function := range aggregateFunctions {
+		function := function
+
+		err := conn.RegisterAggregator(function.name, func() *cgoAggregator {
+			return &cgoAggregator{function: function, aggregator: function.new()}
+		}, true)
+		if err != nil {
+			return fmt.Errorf("could not register %s: %w", function.name, err)
+		}
+	}
+
+	return registerModules(conn)
+}
+
+type cgoAggregator struct {
+	aggregator aggregator
+	function   aggregateFunction
+}
+
+func (a *cgoAggregator) Step(args ...any) error {
+	err := checkArgs(a.function.name, a.function.args, args)
+	if err != nil {
+		return err
+	}
+
+	return a.aggregator.step(args)
+}
+
+func (a *cgoAggregator) Done() (any, error) {
+	return a.aggregator.value()
+}
+
+// restrict installs an authorizer, so the query can only do what authorize allows.
+func restrict(conn *sql.Conn, _ string) (func() string, error) {
+	var denied string
+
+	err := conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected connection %T", driverConn)
+		}
+
+		sqliteConn.RegisterAuthorizer(func(action int, arg1, arg2, database string) int {
+			reason := authorize(action, arg1, arg2, database)
+			if reason == "" {
+				return sqlite3.SQLITE_OK
+			}
+
+			denied = reason
+
+			return sqlite3.SQLITE_DENY
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not install authorizer: %w", err)
+	}
+
+	return func() string {
+		return denied
+	}, nil
+}
@@ -4,7 +4,83 @@
 package services
 
 import (
-	_ "modernc.org/sqlite"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+const (
+	dbDriverName = "sqlite"
+	dbDriverKind = "go"
 )
 
-const dbDriverName = "sqlite"
+// init adds the time series functions, which the driver registers for every connection.
+func init() {
+	for _, function := range scalarFunctions {
+		function := function
+
+		sqlite.MustRegisterDeterministicScalarFunction(
+			function.name,
+			int32(function.args),
+			func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				return function.fn(values(args))
+			},
+		)
+	}
+
+	for _, function := range aggregateFunctions {
+		function := function
+
+		sqlite.MustRegisterFunction(function.name, &sqlite.FunctionImpl{
+			NArgs:         int32(function.args),
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (sqlite.AggregateFunction, error) {
+				return &goAggregator{aggregator: function.new(), name: function.name}, nil
+			},
+		})
+	}
+}
+
+// goAggregator is not a window function, as the cgo driver cannot register one.
+type goAggregator struct {
+	aggregator aggregator
+	name       string
+}
+
+func (a *goAggregator) Step(_ *sqlite.FunctionContext, args []driver.Value) error {
+	return a.aggregator.step(values(args))
+}
+
+func (a *goAggregator) WindowInverse(*sqlite.FunctionContext, []driver.Value) error {
+	return fmt.Errorf("%w: %s may not be used as a window function", ErrFunctionArguments, a.name)
+}
+
+func (a *goAggregator) WindowValue(*sqlite.FunctionContext) (driver.Value, error) {
+	return a.aggregator.value()
+}
+
+func (a *goAggregator) Final(*sqlite.FunctionContext) {}
+
+func values(args []driver.Value) []any {
+	converted := make([]any, len(args))
+	for index, arg := range args {
+		converted[index] = arg
+	}
+
+	return converted
+}
+
+// restrict checks the query against the statement allow-list, as the driver
+// has no authorizer. The connection is already query_only, so it cannot write.
+func restrict(_ *sql.Conn, query string) (func() string, error) {
+	err := allowStatement(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() string {
+		return ""
+	}, nil
+}
@@ -3,23 +3,49 @@ package services
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/jtarchie/ringbuffer"
 	"github.com/jtarchie/sqlite-tsdb/sdk"
 	"github.com/jtarchie/worker"
 	"go.uber.org/zap"
 )
 
 type Switcher struct {
-	buffer    *ringbuffer.Channel[sdk.Event]
+	accepted  uint64
+	buffer    *Buffer[sdk.Event]
 	count     uint64
+	done      chan struct{}
+	drops     *dropTracker
 	flushSize int
+	// local guards writer rotations and the writers waiting to be finalized
+	local     sync.Mutex
 	logger    *zap.Logger
+	overflow  Overflow
 	path      string
+	pending   int64
+	unflushed map[string]*Writer
+	rejected  uint64
 	worker    *worker.Worker[*Writer]
-	writer    *Writer
+	writer    atomic.Pointer[Writer]
+}
+
+// SwitcherStats is a point in time summary of the events moving through a Switcher.
+type SwitcherStats struct {
+	Accepted       uint64
+	Written        uint64
+	Dropped        uint64
+	Rejected       uint64
+	BufferCapacity int
+	BufferUsage    int
+	WriterFilename string
+	WriterRows     uint64
+	Pending        int64
+
+	// DroppedLabels is a sample of the label sets dropped, with their counts.
+	DroppedLabels map[string]uint64
 }
 
 type Finalizer interface {
@@ -36,9 +62,19 @@ func NewSwitcher(
 	path string,
 	flushSize int,
 	bufferSize int,
+	overflow Overflow,
 	finalizer Finalizer,
 	logger *zap.Logger,
 ) (*Switcher, error) {
+	if overflow.Policy == "" {
+		overflow.Policy = OverflowDropOldest
+	}
+
+	err := overflow.validate()
+	if err != nil {
+		return nil, err
+	}
+
 	writer, err := newNamedWriter(path, logger)
 	if err != nil {
 		return nil, fmt.Errorf("could not create initial writer: %w", err)
@@ -46,22 +82,38 @@ func NewSwitcher(
 
 	workerQueue := 100
 
+	bufferCapacity.Set(float64(bufferSize))
+
+	drops := newDropTracker(logger)
+
 	switcher := &Switcher{
-		buffer:    ringbuffer.NewChannel[sdk.Event](bufferSize),
+		buffer:    NewBuffer(bufferSize, drops.record),
 		count:     0,
+		done:      make(chan struct{}),
+		drops:     drops,
 		flushSize: flushSize,
 		logger:    logger,
+		overflow:  overflow,
 		path:      path,
-		writer:    writer,
-		worker: worker.New(workerQueue, 1, func(i int, writer *Writer) {
-			logger.Info("worker start",
-				zap.Int("worker", i),
-				zap.String("filename", writer.Filename()),
-			)
-			writer.Close()
-			finalizer.Finalize(writer.Filename())
-		}),
+		unflushed: map[string]*Writer{},
 	}
+	switcher.writer.Store(writer)
+	switcher.worker = worker.New(workerQueue, 1, func(i int, writer *Writer) {
+		defer atomic.AddInt64(&switcher.pending, -1)
+		defer finalizeQueue.Dec()
+
+		logger.Info("worker start",
+			zap.Int("worker", i),
+			zap.String("filename", writer.Filename()),
+		)
+		writer.Close()
+		finalizer.Finalize(writer.Filename())
+
+		switcher.local.Lock()
+		delete(switcher.unflushed, writer.Filename())
+		switcher.local.Unlock()
+	})
+
 	go switcher.process()
 
 	return switcher, nil
@@ -76,42 +128,153 @@ func newNamedWriter(path string, logger *zap.Logger) (*Writer, error) {
 func (s *Switcher) process() {
 	var err error
 
-	defer s.buffer.Close()
+	defer close(s.done)
 
 	for {
-		event := s.buffer.Read()
+		event, ok := s.buffer.Read()
+		if !ok {
+			return
+		}
 
-		_ = s.writer.Insert(&event)
+		bufferDepth.Set(float64(s.buffer.Len()))
+
+		writer := s.writer.Load()
+
+		err = writer.Insert(&event)
+		if err != nil {
+			eventsWriteErrors.Inc()
+		} else {
+			eventsWritten.Inc()
+		}
+
+		writerRows.Set(float64(writer.Count()))
 
 		current := atomic.AddUint64(&s.count, 1)
 		if current%uint64(s.flushSize) == 0 {
-			previousWriter := s.writer
+			s.rotate(writer)
+		}
+	}
+}
 
-			s.writer, err = newNamedWriter(s.path, s.logger)
-			if err != nil {
-				s.logger.Error("could not init new writer", zap.Error(err))
-			}
+// rotate replaces the active writer with a new one, and finalizes the old one.
+// When the new writer cannot be created, the active one is kept, to be
+// rotated at the next flush.
+func (s *Switcher) rotate(writer *Writer) {
+	nextWriter, err := newNamedWriter(s.path, s.logger)
+	if err != nil {
+		s.logger.Error("could not init new writer, keeping the active one", zap.Error(err))
+
+		return
+	}
+
+	s.local.Lock()
+	s.unflushed[writer.Filename()] = writer
+	s.writer.Store(nextWriter)
+	s.local.Unlock()
+
+	writerRows.Set(0)
+	rotations.Inc()
+	finalizeQueue.Inc()
+	atomic.AddInt64(&s.pending, 1)
+
+	s.worker.Enqueue(writer)
+}
 
-			s.worker.Enqueue(previousWriter)
+// Insert buffers an event to be written. Depending on the overflow policy,
+// a full buffer either drops an older event or refuses this one with
+// ErrBufferFull or ErrBufferTimeout.
+func (s *Switcher) Insert(event *sdk.Event) error {
+	switch s.overflow.Policy {
+	case OverflowReject:
+		if !s.buffer.TryWrite(*event) {
+			return s.reject(ErrBufferFull)
 		}
+	case OverflowBlock:
+		if !s.buffer.WriteTimeout(*event, s.overflow.Timeout) {
+			return s.reject(ErrBufferTimeout)
+		}
+	case OverflowDropOldest:
+		s.buffer.Write(*event)
 	}
+
+	atomic.AddUint64(&s.accepted, 1)
+	eventsInserted.Inc()
+
+	return nil
 }
 
-func (s *Switcher) Insert(event *sdk.Event) {
-	s.buffer.Write(*event)
+func (s *Switcher) reject(err error) error {
+	atomic.AddUint64(&s.rejected, 1)
+	eventsRejected.Inc()
+
+	return err
 }
 
 func (s *Switcher) Count() uint64 {
 	return atomic.LoadUint64(&s.count)
 }
 
+func (s *Switcher) Stats() SwitcherStats {
+	writer := s.writer.Load()
+
+	return SwitcherStats{
+		Accepted:       atomic.LoadUint64(&s.accepted),
+		Written:        atomic.LoadUint64(&s.count),
+		Dropped:        s.buffer.Dropped(),
+		Rejected:       atomic.LoadUint64(&s.rejected),
+		DroppedLabels:  s.drops.sample(),
+		BufferCapacity: s.buffer.Cap(),
+		BufferUsage:    s.buffer.Len(),
+		WriterFilename: writer.Filename(),
+		WriterRows:     writer.Count(),
+		Pending:        atomic.LoadInt64(&s.pending),
+	}
+}
+
+// LocalFiles are the filenames of the active database and those waiting to be finalized.
+func (s *Switcher) LocalFiles() []string {
+	s.local.Lock()
+	defer s.local.Unlock()
+
+	filenames := []string{}
+	for filename := range s.unflushed {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	return append(filenames, s.writer.Load().Filename())
+}
+
+// ReadLocal calls fn when the local file can be read, waiting while it is being finalized.
+func (s *Switcher) ReadLocal(filename string, fn func() error) error {
+	s.local.Lock()
+
+	writer, ok := s.unflushed[filename]
+	if active := s.writer.Load(); active.Filename() == filename {
+		writer, ok = active, true
+	}
+
+	s.local.Unlock()
+
+	if !ok {
+		// already finalized, the file is left in place after upload
+		return fn()
+	}
+
+	return writer.read(fn)
+}
+
+// Close writes the buffered events and closes the active writer.
+// Insert must not be called after Close.
 func (s *Switcher) Close() error {
-	err := s.writer.Close()
+	s.buffer.Close()
+	<-s.done
+
+	err := s.writer.Load().Close()
 	if err != nil {
 		return fmt.Errorf("could not close writer: %w", err)
 	}
 
-	s.buffer.Close()
-
 	return nil
 }
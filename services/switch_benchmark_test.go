@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gmeasure"
+	"go.uber.org/zap"
+)
+
+// ingest sends events at a rate (events per second) for a duration,
+// or as fast as possible when the rate is 0.
+func ingest(switcher *services.Switcher, rate int, duration time.Duration) {
+	event := &sdk.Event{
+		Labels: sdk.Labels{"user_id": "1234"},
+		Value:  "benchmark",
+	}
+
+	if rate == 0 {
+		for start := time.Now(); time.Since(start) < duration; {
+			_ = switcher.Insert(event)
+		}
+
+		return
+	}
+
+	const tick = time.Millisecond
+
+	perTick := rate / int(time.Second/tick)
+	ticker := time.NewTicker(tick)
+
+	defer ticker.Stop()
+
+	for start := time.Now(); time.Since(start) < duration; <-ticker.C {
+		for i := 0; i < perTick; i++ {
+			_ = switcher.Insert(event)
+		}
+	}
+}
+
+var _ = Describe("Switcher back pressure relief", Ordered, Serial, Label("measurement"), func() {
+	experiment := gmeasure.NewExperiment("Drop rate by buffer size and ingest rate")
+
+	AfterAll(func() {
+		AddReportEntry(experiment.Name, experiment)
+	})
+
+	for _, bufferSize := range []int{10, 1_000, 10_000} {
+		for _, rate := range []int{10_000, 100_000, 0} {
+			bufferSize, rate := bufferSize, rate
+
+			name := fmt.Sprintf("buffer=%d rate=%d/s", bufferSize, rate)
+			if rate == 0 {
+				name = fmt.Sprintf("buffer=%d rate=unbounded", bufferSize)
+			}
+
+			It(name, func() {
+				workPath, err := os.MkdirTemp("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				defer os.RemoveAll(workPath)
+
+				switcher, err := services.NewSwitcher(
+					workPath,
+					10_000_000,
+					bufferSize,
+					services.Overflow{Policy: services.OverflowDropOldest},
+					services.FinalizerWrap(func(string) {}),
+					zap.NewNop(),
+				)
+				Expect(err).NotTo(HaveOccurred())
+
+				ingest(switcher, rate, 200*time.Millisecond)
+				Expect(switcher.Close()).To(Succeed())
+
+				stats := switcher.Stats()
+				Expect(stats.Written + stats.Dropped).To(Equal(stats.Accepted))
+
+				experiment.RecordValue(
+					name,
+					100*float64(stats.Dropped)/float64(stats.Accepted),
+					gmeasure.Units("% dropped"),
+					gmeasure.Precision(2),
+				)
+			})
+		}
+	}
+})
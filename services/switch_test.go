@@ -0,0 +1,180 @@
+package services_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jtarchie/sqlite-tsdb/sdk"
+	"github.com/jtarchie/sqlite-tsdb/services"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var _ = Describe("Switcher", func() {
+	It("reports the events moving through it", func() {
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(workPath)
+
+		finalized := make(chan string, 10)
+
+		switcher, err := services.NewSwitcher(workPath, 3, 10, services.Overflow{}, services.FinalizerWrap(func(filename string) {
+			finalized <- filename
+		}), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 4; i++ {
+			Expect(switcher.Insert(&sdk.Event{Time: sdk.Time(i)})).To(Succeed())
+		}
+
+		Eventually(func() uint64 {
+			return switcher.Stats().Written
+		}).Should(BeEquivalentTo(4))
+		Eventually(finalized).Should(Receive())
+
+		stats := switcher.Stats()
+		Expect(stats.Accepted).To(BeEquivalentTo(4))
+		Expect(stats.Dropped).To(BeEquivalentTo(0))
+		Expect(stats.BufferCapacity).To(Equal(10))
+		Expect(stats.WriterRows).To(BeEquivalentTo(1))
+		Expect(filepath.Dir(stats.WriterFilename)).To(Equal(workPath))
+		Eventually(func() int64 {
+			return switcher.Stats().Pending
+		}).Should(BeEquivalentTo(0))
+
+		Expect(switcher.Close()).To(Succeed())
+	})
+
+	It("warns about the first drop without a time since the last warning", func() {
+		core, logs := observer.New(zap.WarnLevel)
+
+		tracker := services.NewDropTracker(zap.New(core))
+		tracker.Record(sdk.Event{})
+		tracker.Record(sdk.Event{})
+
+		warnings := logs.FilterMessage("dropping events, the buffer is full").All()
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0].ContextMap()).To(Equal(map[string]any{"dropped": uint64(1)}))
+	})
+
+	It("samples the label sets of dropped events", func() {
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(workPath)
+
+		switcher, err := services.NewSwitcher(workPath, 100_000, 1, services.Overflow{}, services.FinalizerWrap(func(string) {}), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		for i := 0; i < 1_000; i++ {
+			Expect(switcher.Insert(&sdk.Event{Labels: sdk.Labels{"b": "2", "a": "1"}})).To(Succeed())
+		}
+
+		Expect(switcher.Close()).To(Succeed())
+
+		stats := switcher.Stats()
+		Expect(stats.Written + stats.Dropped).To(BeEquivalentTo(1_000))
+		Expect(stats.DroppedLabels[`{a="1",b="2"}`]).To(Equal(stats.Dropped))
+	})
+
+	It("keeps the active writer when the next one cannot be created", func() {
+		tempPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(tempPath)
+
+		workPath := filepath.Join(tempPath, "work")
+		Expect(os.Mkdir(workPath, 0o700)).To(Succeed())
+
+		finalized := make(chan string, 10)
+
+		switcher, err := services.NewSwitcher(workPath, 1, 10, services.Overflow{}, services.FinalizerWrap(func(filename string) {
+			finalized <- filename
+		}), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		filename := switcher.Stats().WriterFilename
+
+		// the next writer cannot be created
+		Expect(os.RemoveAll(workPath)).To(Succeed())
+
+		for i := 0; i < 2; i++ {
+			Expect(switcher.Insert(&sdk.Event{Time: sdk.Time(i)})).To(Succeed())
+		}
+
+		Eventually(func() uint64 {
+			return switcher.Stats().Written
+		}).Should(BeEquivalentTo(2))
+		Expect(switcher.LocalFiles()).To(Equal([]string{filename}))
+		Expect(switcher.CheckWriter()).To(Succeed())
+		Consistently(finalized).ShouldNot(Receive())
+
+		Expect(os.Mkdir(workPath, 0o700)).To(Succeed())
+		Expect(switcher.Insert(&sdk.Event{Time: 2})).To(Succeed())
+
+		Eventually(finalized).Should(Receive(Equal(filename)))
+		Expect(switcher.Stats().WriterFilename).NotTo(Equal(filename))
+		Expect(switcher.Close()).To(Succeed())
+	})
+
+	When("the overflow policy refuses events", func() {
+		var workPath string
+
+		BeforeEach(func() {
+			var err error
+
+			workPath, err = os.MkdirTemp("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			DeferCleanup(os.RemoveAll, workPath)
+		})
+
+		It("rejects events when the buffer is full", func() {
+			switcher, err := services.NewSwitcher(workPath, 100_000, 1, services.Overflow{
+				Policy: services.OverflowReject,
+			}, services.FinalizerWrap(func(string) {}), zap.NewNop())
+			Expect(err).NotTo(HaveOccurred())
+
+			var rejected error
+			for i := 0; i < 1_000 && rejected == nil; i++ {
+				rejected = switcher.Insert(&sdk.Event{})
+			}
+
+			Expect(rejected).To(MatchError(services.ErrBufferFull))
+			Expect(switcher.Close()).To(Succeed())
+
+			stats := switcher.Stats()
+			Expect(stats.Rejected).To(BeEquivalentTo(1))
+			Expect(stats.Dropped).To(BeEquivalentTo(0))
+			Expect(stats.Written).To(Equal(stats.Accepted))
+		})
+
+		It("times out waiting for room when blocking", func() {
+			switcher, err := services.NewSwitcher(workPath, 100_000, 1, services.Overflow{
+				Policy:  services.OverflowBlock,
+				Timeout: time.Nanosecond,
+			}, services.FinalizerWrap(func(string) {}), zap.NewNop())
+			Expect(err).NotTo(HaveOccurred())
+
+			var rejected error
+			for i := 0; i < 1_000 && rejected == nil; i++ {
+				rejected = switcher.Insert(&sdk.Event{})
+			}
+
+			Expect(rejected).To(MatchError(services.ErrBufferTimeout))
+			Expect(switcher.Close()).To(Succeed())
+			Expect(switcher.Stats().Dropped).To(BeEquivalentTo(0))
+		})
+
+		It("requires a timeout to block", func() {
+			_, err := services.NewSwitcher(workPath, 1, 1, services.Overflow{
+				Policy: services.OverflowBlock,
+			}, services.FinalizerWrap(func(string) {}), zap.NewNop())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
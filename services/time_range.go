@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeRange bounds a query by event time. A zero Start or End is unbounded.
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime accepts RFC3339, a date, or an integer of unix nanoseconds.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if nanos, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, nanos).UTC(), nil
+	}
+
+	for _, layout := range timeLayouts {
+		parsed, err := time.Parse(layout, value)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("could not parse time %q", value)
+}
+
+// NewTimeRange parses both ends of a range with ParseTime.
+func NewTimeRange(start, end string) (TimeRange, error) {
+	startTime, err := ParseTime(start)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("invalid start: %w", err)
+	}
+
+	endTime, err := ParseTime(end)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("invalid end: %w", err)
+	}
+
+	return TimeRange{Start: startTime, End: endTime}, nil
+}
+
+// Overlaps reports whether any part of [min, max] falls inside the range.
+func (t TimeRange) Overlaps(min, max time.Time) bool {
+	if !t.Start.IsZero() && max.Before(t.Start) {
+		return false
+	}
+
+	if !t.End.IsZero() && min.After(t.End) {
+		return false
+	}
+
+	return true
+}
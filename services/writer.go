@@ -1,19 +1,26 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jtarchie/sqlite-tsdb/sdk"
 	"go.uber.org/zap"
 )
 
 type Writer struct {
-	db       *sql.DB
-	filename string
-	insert   *sql.Stmt
-	logger   *zap.Logger
+	count     uint64
+	createdAt time.Time
+	db        *sql.DB
+	filename  string
+	insert    *sql.Stmt
+	logger    *zap.Logger
+	mutex     sync.RWMutex
 }
 
 func NewWriter(
@@ -36,25 +43,12 @@ func NewWriter(
 		PRAGMA journal_mode = WAL;
 		PRAGMA synchronous = NORMAL;
 		PRAGMA wal_autocheckpoint = 0;
-		CREATE TABLE IF NOT EXISTS payloads (
-			id         INTEGER PRIMARY KEY,
-			payload    TEXT NOT NULL,
-			timestamp  INT GENERATED ALWAYS AS (payload->'$.timestamp') VIRTUAL,
-			value      TEXT GENERATED ALWAYS AS (payload->'$.value') VIRTUAL
-		);
-		CREATE TABLE IF NOT EXISTS metadata (
-			id    INTEGER PRIMARY KEY,
-			key   TEXT NOT NULL,
-			value TEXT NOT NULL
-		);
-		INSERT INTO metadata(key, value) VALUES ('version', '1');
-		CREATE INDEX IF NOT EXISTS payloads_timestamp ON payloads(timestamp);
-		CREATE VIRTUAL TABLE events USING fts5(value, content=payloads, content_rowid=id);
-		CREATE TRIGGER payload_insert AFTER INSERT ON payloads BEGIN
-  		INSERT INTO events(rowid, value) VALUES (new.id, new.value);
-		END;
 	`)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure %q: %w", filename, err)
+	}
 
+	err = migrate(db)
 	if err != nil {
 		return nil, fmt.Errorf("could not run migrations %q: %w", filename, err)
 	}
@@ -65,10 +59,11 @@ func NewWriter(
 	}
 
 	return &Writer{
-		db:       db,
-		filename: filename,
-		insert:   insert,
-		logger:   logger,
+		createdAt: time.Now(),
+		db:        db,
+		filename:  filename,
+		insert:    insert,
+		logger:    logger,
 	}, nil
 }
 
@@ -83,10 +78,51 @@ func (s *Writer) Insert(event *sdk.Event) error {
 		return fmt.Errorf("could not insert payload: %w", err)
 	}
 
+	atomic.AddUint64(&s.count, 1)
+
+	return nil
+}
+
+// Merge copies the payloads of another database file into this one.
+func (s *Writer) Merge(filename string) error {
+	ctx := context.Background()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("could not get connection: %w", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `ATTACH DATABASE ? AS source;`, filename)
+	if err != nil {
+		return fmt.Errorf("could not attach %q: %w", filename, err)
+	}
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO payloads (payload) SELECT payload FROM source.payloads ORDER BY id;`)
+	if err != nil {
+		return fmt.Errorf("could not copy payloads from %q: %w", filename, err)
+	}
+
+	_, err = conn.ExecContext(ctx, `DETACH DATABASE source;`)
+	if err != nil {
+		return fmt.Errorf("could not detach %q: %w", filename, err)
+	}
+
 	return nil
 }
 
+// read calls fn while the file is not being closed, so another connection can read it.
+func (s *Writer) read(fn func() error) error {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return fn()
+}
+
 func (s *Writer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
 	s.logger.Info("closing writer")
 
 	err := s.insert.Close()
@@ -94,6 +130,11 @@ func (s *Writer) Close() error {
 		return fmt.Errorf("cannot close insert prepared statement: %w", err)
 	}
 
+	err = writeMetadata(s.db, s.createdAt)
+	if err != nil {
+		return fmt.Errorf("cannot write metadata: %w", err)
+	}
+
 	_, err = s.db.Exec(`
 		PRAGMA JOURNAL_MODE = DELETE; -- to be able to actually set page size
 		PRAGMA PAGE_SIZE = 1024;      -- trade off of number of requests that need to be made vs overhead.
@@ -115,3 +156,8 @@ func (s *Writer) Close() error {
 func (s *Writer) Filename() string {
 	return s.filename
 }
+
+// Count is the number of events inserted since the writer was created.
+func (s *Writer) Count() uint64 {
+	return atomic.LoadUint64(&s.count)
+}
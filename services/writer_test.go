@@ -1,7 +1,9 @@
 package services_test
 
 import (
+	"database/sql"
 	"os"
+	"path/filepath"
 
 	"github.com/jtarchie/sqlite-tsdb/sdk"
 	"github.com/jtarchie/sqlite-tsdb/services"
@@ -40,3 +42,100 @@ var _ = Describe("Writer", func() {
 		Expect(info.Size()).To(BeNumerically(">", 0))
 	})
 })
+
+var _ = Describe("Writer views", func() {
+	It("presents the events without their JSON layout", func() {
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(os.RemoveAll, workPath)
+
+		writer, err := services.NewWriter(filepath.Join(workPath, "1.db"), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		err = writer.Insert(&sdk.Event{
+			Time:   sdk.Time(1672531200123000000),
+			Labels: sdk.Labels{"product_name": "Terraform", "order_id": "111"},
+			Value:  "ordered",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+
+		db, err := sql.Open(services.DBDriverName, writer.Filename())
+		Expect(err).NotTo(HaveOccurred())
+
+		defer db.Close()
+
+		var (
+			id, ts                 int64
+			timeISO, value, labels string
+		)
+
+		err = db.QueryRow(`SELECT id, ts, time_iso, value, labels_json FROM events_view`).Scan(&id, &ts, &timeISO, &value, &labels)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ts).To(BeEquivalentTo(1672531200123000000))
+		Expect(timeISO).To(Equal("2023-01-01T00:00:00.123Z"))
+		Expect(value).To(Equal("ordered"))
+		Expect(labels).To(MatchJSON(`{"product_name":"Terraform","order_id":"111"}`))
+
+		rows, err := db.Query(`SELECT id, key, value FROM event_labels ORDER BY key`)
+		Expect(err).NotTo(HaveOccurred())
+
+		defer rows.Close()
+
+		pairs := []string{}
+
+		for rows.Next() {
+			var (
+				labelID    int64
+				key, value string
+			)
+
+			Expect(rows.Scan(&labelID, &key, &value)).To(Succeed())
+			Expect(labelID).To(Equal(id))
+
+			pairs = append(pairs, key+"="+value)
+		}
+
+		Expect(rows.Err()).NotTo(HaveOccurred())
+		Expect(pairs).To(Equal([]string{"order_id=111", "product_name=Terraform"}))
+	})
+})
+
+var _ = Describe("Writer metadata", func() {
+	It("records the contents and origin when closed", func() {
+		workPath, err := os.MkdirTemp("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		defer os.RemoveAll(workPath)
+
+		writer, err := services.NewWriter(filepath.Join(workPath, "1.db"), zap.NewNop())
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, event := range []sdk.Event{
+			{Time: 100, Labels: sdk.Labels{"b": "1", "a": "2"}},
+			{Time: 300, Labels: sdk.Labels{"a": "3"}},
+		} {
+			event := event
+			err = writer.Insert(&event)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		metadata, err := services.ReadMetadata(writer.Filename())
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(metadata).To(HaveKeyWithValue("min_timestamp", "100"))
+		Expect(metadata).To(HaveKeyWithValue("max_timestamp", "300"))
+		Expect(metadata).To(HaveKeyWithValue("count", "2"))
+		Expect(metadata).To(HaveKeyWithValue("label_keys", `["a","b"]`))
+		Expect(metadata).To(HaveKeyWithValue("instance_id", services.InstanceID))
+		Expect(metadata).To(HaveKey("hostname"))
+		Expect(metadata).To(HaveKey("software_version"))
+		Expect(metadata).To(HaveKeyWithValue("driver", Or(Equal("cgo"), Equal("go"))))
+		Expect(metadata).To(HaveKey("created_at"))
+		Expect(metadata).To(HaveKey("closed_at"))
+	})
+})
@@ -30,7 +30,7 @@ var path string
 var _ = SynchronizedBeforeSuite(func() []byte {
 	path, err := gexec.Build(
 		"github.com/jtarchie/sqlite-tsdb",
-		"--tags", "fts5 json1",
+		"--tags", "fts5 json1 sqlite_vtable",
 	)
 	Expect(err).NotTo(HaveOccurred())
 